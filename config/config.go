@@ -12,24 +12,168 @@ import (
 	"github.com/go-emd/emd/log"
 	"encoding/json"
 	"io/ioutil"
+	"time"
+)
+
+// The connection types the leader.template file 
+// knows how to build.  Each one is named after the 
+// connector implementation it creates.
+const (
+	LocalIngress        = "LocalIngress"
+	LocalEgress         = "LocalEgress"
+	ExternalUDPIngress  = "ExternalUDPIngress"
+	ExternalUDPEgress   = "ExternalUDPEgress"
+	ExternalTCPIngress  = "ExternalTCPIngress"
+	ExternalTCPEgress   = "ExternalTCPEgress"
+	ExternalUnixIngress = "ExternalUnixIngress"
+	ExternalUnixEgress  = "ExternalUnixEgress"
+)
+
+// The delivery modes an External connection can 
+// run in.  Leaving the Delivery empty is the same 
+// as DeliveryAtMostOnce.
+const (
+	DeliveryAtMostOnce  = "AtMostOnce"
+	DeliveryAtLeastOnce = "AtLeastOnce"
+)
+
+// The codecs an External connection can encode its 
+// values with.  Leaving the Codec empty is the same 
+// as CodecGob.
+const (
+	CodecGob  = "Gob"
+	CodecJSON = "JSON"
+	CodecRaw  = "Raw"
+)
+
+// The restart policies of a worker, they tell the 
+// leader what to do once the worker's Run returns or 
+// panics.  Leaving the Restart empty is the same as 
+// RestartNever.
+const (
+	RestartNever     = "Never"
+	RestartAlways    = "Always"
+	RestartOnFailure = "OnFailure"
 )
 
 // Contains the variables related to a
 // connector interface allowing the leader.template 
-// file fill in these parameters.
+// file fill in these parameters.  Delivery and Codec 
+// only apply to External connections and must be the 
+// same on both ends of the connection.
 type Connection struct {
-	Type   string
-	Worker string
-	Alias  string
-	Buffer string
+	Type     string
+	Worker   string
+	Alias    string
+	Buffer   string
+	Delivery string `json:",omitempty"`
+	Codec    string `json:",omitempty"`
+}
+
+// Returns true if the connection type is one 
+// that the leader.template file can build and the 
+// delivery mode and codec make sense for it.
+func (c Connection) Valid() bool {
+	return c.ValidType() && c.ValidDelivery() && c.ValidCodec()
+}
+
+// Returns true if the connection type is one 
+// that the leader.template file can build.
+func (c Connection) ValidType() bool {
+	switch c.Type {
+	case LocalIngress, LocalEgress:
+		return true
+	}
+
+	return c.External()
+}
+
+// Returns true if the delivery mode is known and, 
+// when it is AtLeastOnce, the connection is External.
+func (c Connection) ValidDelivery() bool {
+	switch c.Delivery {
+	case "", DeliveryAtMostOnce:
+		return true
+	case DeliveryAtLeastOnce:
+		return c.External()
+	}
+
+	return false
+}
+
+// Returns true if the codec is known and, when 
+// one is given, the connection is External.
+func (c Connection) ValidCodec() bool {
+	switch c.Codec {
+	case "":
+		return true
+	case CodecGob, CodecJSON, CodecRaw:
+		return c.External()
+	}
+
+	return false
+}
+
+// Returns true if the connection goes between 
+// leaders.  The UDP and TCP connections need a host 
+// and port while the Unix connections use a socket 
+// path derived from the Alias.
+func (c Connection) External() bool {
+	switch c.Type {
+	case ExternalUDPIngress, ExternalUDPEgress,
+		ExternalTCPIngress, ExternalTCPEgress,
+		ExternalUnixIngress, ExternalUnixEgress:
+		return true
+	}
+
+	return false
 }
 
 // Basic configuration of a worker in 
-// a distribution.  It contains only the name of 
-// the worker and all of its connections.
+// a distribution.  It contains the name of the 
+// worker, all of its connections and how it is 
+// restarted.  MaxRestarts limits the number of 
+// restarts, zero meaning no limit, and Backoff is 
+// the first wait between restarts, such as "1s", 
+// which doubles after every restart.
 type WorkConfig struct {
 	Name        string
 	Connections []Connection
+	Restart     string `json:",omitempty"`
+	MaxRestarts int    `json:",omitempty"`
+	Backoff     string `json:",omitempty"`
+}
+
+// Returns true if every connection of the worker 
+// is valid and its restart policy makes sense.
+func (w WorkConfig) Valid() bool {
+	for _, c := range w.Connections {
+		if !c.Valid() {
+			return false
+		}
+	}
+
+	switch w.Restart {
+	case "", RestartNever:
+		if w.MaxRestarts != 0 || w.Backoff != "" {
+			return false
+		}
+	case RestartAlways, RestartOnFailure:
+	default:
+		return false
+	}
+
+	if w.MaxRestarts < 0 {
+		return false
+	}
+
+	if w.Backoff != "" {
+		if d, err := time.ParseDuration(w.Backoff); err != nil || d <= 0 {
+			return false
+		}
+	}
+
+	return true
 }
 
 // Contains all of the basic information 
@@ -41,12 +185,66 @@ type NodeConfig struct {
 	Workers  []WorkConfig
 }
 
+// How the leaders keep the history of their workers' 
+// metrics.  Interval is how often the metrics are sampled, 
+// such as "10s", and Samples how many samples of each 
+// worker are kept.  Either left empty takes its default.
+type History struct {
+	Interval string `json:",omitempty"`
+	Samples  int    `json:",omitempty"`
+}
+
+// The defaults of the History, an hour of samples taken 
+// every ten seconds.
+const (
+	DefaultHistoryInterval = time.Second * 10
+	DefaultHistorySamples  = 360
+)
+
+// Returns true if the Interval is a positive duration and 
+// the Samples is not negative.
+func (h History) Valid() bool {
+	if h.Samples < 0 {
+		return false
+	}
+
+	if h.Interval != "" {
+		if d, err := time.ParseDuration(h.Interval); err != nil || d <= 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Returns the Interval as a duration, or its default.
+func (h History) Period() time.Duration {
+	if d, err := time.ParseDuration(h.Interval); err == nil && d > 0 {
+		return d
+	}
+
+	return DefaultHistoryInterval
+}
+
+// Returns the number of samples kept, or its default.
+func (h History) Limit() int {
+	if h.Samples > 0 {
+		return h.Samples
+	}
+
+	return DefaultHistorySamples
+}
+
 // Contains misc things emd needs to know such 
-// as if a NFS exists and what port to listen for REST 
-// requests.  It contains all the nodes in the distribution.
+// as if a NFS exists, what port to listen for REST 
+// requests and how they are secured.  It contains all 
+// the nodes in the distribution and how much of their 
+// metrics history the leaders keep.
 type Config struct {
 	Nfs      bool
 	GUI_port string
+	Security Security
+	History  History
 	Nodes    []NodeConfig
 }
 
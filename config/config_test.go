@@ -3,6 +3,7 @@ package config
 import (
 	"testing"
 	"reflect"
+	"time"
 )
 
 func TestProcess(t *testing.T) {
@@ -36,3 +37,148 @@ func TestProcess(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestConnectionValid(t *testing.T) {
+	for _, c := range []Connection{
+		{Type: LocalEgress},
+		{Type: ExternalUDPIngress},
+		{Type: ExternalTCPEgress},
+		{Type: ExternalUnixIngress, Delivery: DeliveryAtLeastOnce},
+	} {
+		if !c.Valid() {
+			t.Errorf("%s should be valid", c.Type)
+		}
+	}
+
+	if (Connection{Type: "Carrier pigeon"}).Valid() {
+		t.Fail()
+	}
+
+	if !(Connection{Type: ExternalUDPEgress, Delivery: DeliveryAtLeastOnce}).Valid() {
+		t.Fail()
+	}
+
+	if (Connection{Type: LocalEgress, Delivery: DeliveryAtLeastOnce}).Valid() {
+		t.Fail()
+	}
+
+	// Each field is checked on its own.
+	if c := (Connection{Type: "Carrier pigeon"}); c.ValidType() || !c.ValidDelivery() {
+		t.Error("unexpected type check", c)
+	}
+
+	if c := (Connection{Type: LocalEgress, Delivery: DeliveryAtLeastOnce}); !c.ValidType() || c.ValidDelivery() {
+		t.Error("unexpected delivery check", c)
+	}
+
+	if c := (Connection{Type: ExternalTCPEgress, Delivery: "Twice"}); !c.ValidType() || c.ValidDelivery() {
+		t.Error("unexpected delivery check", c)
+	}
+
+	if c := (Connection{Type: ExternalTCPIngress, Codec: "XML"}); !c.ValidType() || !c.ValidDelivery() || c.ValidCodec() {
+		t.Error("unexpected codec check", c)
+	}
+
+	if c := (Connection{Type: LocalIngress, Codec: CodecJSON}); c.Valid() || c.ValidCodec() {
+		t.Error("unexpected codec check", c)
+	}
+
+	if !(Connection{Type: ExternalTCPIngress, Codec: CodecJSON}).Valid() {
+		t.Fail()
+	}
+
+	if (Connection{Type: ExternalTCPIngress, Codec: "XML"}).Valid() {
+		t.Fail()
+	}
+
+	if (Connection{Type: LocalIngress}).External() || !(Connection{Type: ExternalTCPIngress}).External() {
+		t.Fail()
+	}
+}
+
+func TestWorkConfigValid(t *testing.T) {
+	for _, w := range []WorkConfig{
+		{Name: "A"},
+		{Name: "A", Restart: RestartNever},
+		{Name: "A", Restart: RestartAlways},
+		{Name: "A", Restart: RestartOnFailure, MaxRestarts: 5, Backoff: "500ms"},
+	} {
+		if !w.Valid() {
+			t.Errorf("%+v should be valid", w)
+		}
+	}
+
+	for _, w := range []WorkConfig{
+		{Name: "A", Restart: "Sometimes"},
+		{Name: "A", MaxRestarts: 5},
+		{Name: "A", Restart: RestartNever, Backoff: "1s"},
+		{Name: "A", Restart: RestartAlways, MaxRestarts: -1},
+		{Name: "A", Restart: RestartAlways, Backoff: "soon"},
+		{Name: "A", Restart: RestartAlways, Backoff: "-1s"},
+		{Name: "A", Connections: []Connection{{Type: "Carrier pigeon"}}},
+	} {
+		if w.Valid() {
+			t.Errorf("%+v should be invalid", w)
+		}
+	}
+}
+
+func TestHistory(t *testing.T) {
+	for _, h := range []History{{}, {Interval: "1m"}, {Samples: 10}} {
+		if !h.Valid() {
+			t.Errorf("%+v should be valid", h)
+		}
+	}
+
+	for _, h := range []History{{Interval: "often"}, {Interval: "-1s"}, {Samples: -1}} {
+		if h.Valid() {
+			t.Errorf("%+v should be invalid", h)
+		}
+	}
+
+	if (History{}).Period() != DefaultHistoryInterval || (History{}).Limit() != DefaultHistorySamples {
+		t.Fail()
+	}
+
+	if (History{Interval: "1m", Samples: 10}).Period() != time.Minute || (History{Samples: 10}).Limit() != 10 {
+		t.Fail()
+	}
+}
+
+func TestSecurityValid(t *testing.T) {
+	for _, s := range []Security{
+		{},
+		{Tokens: []string{"secret"}, AllowedOrigins: []string{"*"}},
+		{Cert: "cert.pem", Key: "key.pem"},
+		{Cert: "cert.pem", Key: "key.pem", CA: "ca.pem", ClientCA: "ca.pem", ClientCert: "client.pem", ClientKey: "client-key.pem"},
+	} {
+		if !s.Valid() {
+			t.Errorf("%+v should be valid", s)
+		}
+	}
+
+	for _, s := range []Security{
+		{Cert: "cert.pem"},
+		{Key: "key.pem"},
+		{CA: "ca.pem"},
+		{ClientCA: "ca.pem"},
+		{Cert: "cert.pem", Key: "key.pem", ClientCert: "client.pem"},
+		{Tokens: []string{""}},
+	} {
+		if s.Valid() {
+			t.Errorf("%+v should be invalid", s)
+		}
+	}
+
+	if !(Security{}).IsZero() || (Security{Tokens: []string{"secret"}}).IsZero() {
+		t.Fail()
+	}
+
+	if (Security{}).Scheme() != "http" || (Security{Cert: "cert.pem", Key: "key.pem"}).Scheme() != "https" {
+		t.Fail()
+	}
+
+	if _, err := CertPool("config_test.json"); err != ErrNoCertificates {
+		t.Error("unexpected error", err)
+	}
+}
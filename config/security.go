@@ -0,0 +1,135 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net/http"
+)
+
+// Returned when a certificate authority file holds no
+// certificates.
+var ErrNoCertificates = errors.New("config: no certificates found")
+
+// Secures the REST endpoints of the leaders.  When Cert and
+// Key are set the leaders serve over TLS, CA verifies their
+// certificates on the client side and is the system's roots
+// when left empty.
+//
+// The endpoints that change the distribution, such as start
+// and stop, require a bearer token from the Tokens or, when
+// ClientCA is set, a client certificate signed by it.  The
+// emd commands send the first of the Tokens and present the
+// ClientCert and ClientKey.  Without Tokens or a ClientCA
+// anyone reaching the GUI_port may change the distribution.
+//
+// AllowedOrigins lists the origins browsers may call the
+// endpoints from, "*" allowing any.  When it is empty only
+// pages served by the leader itself may call them.
+type Security struct {
+	Cert           string   `json:",omitempty"`
+	Key            string   `json:",omitempty"`
+	CA             string   `json:",omitempty"`
+	ClientCA       string   `json:",omitempty"`
+	ClientCert     string   `json:",omitempty"`
+	ClientKey      string   `json:",omitempty"`
+	Tokens         []string `json:",omitempty"`
+	AllowedOrigins []string `json:",omitempty"`
+}
+
+// Returns true if the files come in pairs and the client
+// side settings are only used along with TLS.
+func (s Security) Valid() bool {
+	if (s.Cert == "") != (s.Key == "") {
+		return false
+	}
+
+	if (s.ClientCert == "") != (s.ClientKey == "") {
+		return false
+	}
+
+	if !s.TLS() && (s.CA != "" || s.ClientCA != "" || s.ClientCert != "") {
+		return false
+	}
+
+	for _, t := range s.Tokens {
+		if t == "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Returns true if nothing is set, the leaders then serve
+// plain http to anyone.
+func (s Security) IsZero() bool {
+	return s.Cert == "" && s.Key == "" && s.CA == "" && s.ClientCA == "" &&
+		s.ClientCert == "" && s.ClientKey == "" &&
+		len(s.Tokens) == 0 && len(s.AllowedOrigins) == 0
+}
+
+// Returns true if the leaders serve over TLS.
+func (s Security) TLS() bool {
+	return s.Cert != ""
+}
+
+// Returns the scheme of the leaders' REST endpoints.
+func (s Security) Scheme() string {
+	if s.TLS() {
+		return "https"
+	}
+
+	return "http"
+}
+
+// Returns the client used to call the leaders, trusting the
+// CA and presenting the ClientCert when they are set.
+func (s Security) Client() (*http.Client, error) {
+	if !s.TLS() {
+		return &http.Client{}, nil
+	}
+
+	cfg := &tls.Config{}
+
+	if s.CA != "" {
+		pool, err := CertPool(s.CA)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+
+	if s.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(s.ClientCert, s.ClientKey)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: cfg}}, nil
+}
+
+// Adds the first of the Tokens to the request.
+func (s Security) Authorize(r *http.Request) {
+	if len(s.Tokens) > 0 {
+		r.Header.Set("Authorization", "Bearer "+s.Tokens[0])
+	}
+}
+
+// Reads the PEM encoded certificates of the file into a pool.
+func CertPool(path string) (*x509.CertPool, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, ErrNoCertificates
+	}
+
+	return pool, nil
+}
@@ -0,0 +1,109 @@
+package connector
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+)
+
+// The names a codec can be selected by, as used in the
+// Codec of a connection in the config.json.
+const (
+	Gob  = "Gob"
+	JSON = "JSON"
+	Raw  = "Raw"
+)
+
+// Returned by the RawCodec when asked to encode anything
+// other than a []byte.
+var ErrRawType = errors.New("codec: raw codec only encodes []byte")
+
+// A Codec turns the values sent through an external connector
+// into bytes and back again.  Every value is encoded on its own
+// so the reader given to Decode holds exactly one value.
+type Codec interface {
+	Encode(w io.Writer, v interface{}) error
+	Decode(r io.Reader) (interface{}, error)
+}
+
+// Returns the codec with the given name, or nil if there is
+// none by that name.  An empty name is the GobCodec.
+func CodecByName(name string) Codec {
+	switch name {
+	case "", Gob:
+		return GobCodec{}
+	case JSON:
+		return JSONCodec{}
+	case Raw:
+		return RawCodec{}
+	}
+
+	return nil
+}
+
+// The default codec.  It uses encoding/gob so the types being
+// sent must be registered with gob.Register on both ends.
+type GobCodec struct{}
+
+// Gob encodes the value as an interface so its type travels
+// with it.
+func (GobCodec) Encode(w io.Writer, v interface{}) error {
+	return gob.NewEncoder(w).Encode(&v)
+}
+
+// Gob decodes a value encoded by GobCodec.Encode.
+func (GobCodec) Decode(r io.Reader) (interface{}, error) {
+	var v interface{}
+	err := gob.NewDecoder(r).Decode(&v)
+	return v, err
+}
+
+// Encodes values as JSON allowing programs not written in Go
+// to talk to a distribution.  Decoded values are whatever
+// encoding/json gives for an interface{}, such as a
+// map[string]interface{} or float64.
+type JSONCodec struct{}
+
+// Writes the value as a JSON document.
+func (JSONCodec) Encode(w io.Writer, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+// Reads a single JSON document.
+func (JSONCodec) Decode(r io.Reader) (interface{}, error) {
+	var v interface{}
+	err := json.NewDecoder(r).Decode(&v)
+	return v, err
+}
+
+// Passes []byte values through untouched for workers that do
+// their own encoding.
+type RawCodec struct{}
+
+// Writes the bytes as they are.
+func (RawCodec) Encode(w io.Writer, v interface{}) error {
+	b, ok := v.([]byte)
+	if !ok {
+		return ErrRawType
+	}
+
+	_, err := w.Write(b)
+	return err
+}
+
+// Reads all the bytes of the value.
+func (RawCodec) Decode(r io.Reader) (interface{}, error) {
+	return ioutil.ReadAll(r)
+}
+
+// Returns the codec the connector was built with, the
+// GobCodec if it was not given one.
+func (e *External) codec() Codec {
+	if e.Codec == nil {
+		return GobCodec{}
+	}
+
+	return e.Codec
+}
@@ -4,17 +4,29 @@
 	
 	There are two types of connectors currently implemented, 
 	the Local connector is a go chan of type interface{} the 
-	other is the External connector currently this only supports
-	UDP as this makes the most sense when performing as fast as 
-	possible communications.  For reliability the user will 
-	need to program either their own connector implementing 
-	the connector interface and inheriting the core.Core 
-	or perform their own ack'ing of messages with UDP.
+	other is the External connector which supports UDP, TCP 
+	and unix domain sockets.  UDP makes the most sense when 
+	performing as fast as possible communications but messages 
+	may be lost.  For reliability use the TCP connectors which 
+	keep a persistent connection open and reconnect when the 
+	other leader restarts.  Leaders on the same host can use 
+	the Unix connectors which work like the TCP ones.
 */
 package connector
 
 import (
 	"github.com/go-emd/emd/core"
+	"context"
+	"errors"
+	"io"
+	"sync"
+)
+
+// The errors returned by Open and Close when they are called 
+// out of order.
+var (
+	ErrAlreadyOpen = errors.New("connector: already open")
+	ErrNotOpen     = errors.New("connector: not open")
 )
 
 // Every connector must implement this interface, the interface 
@@ -22,9 +34,15 @@ import (
 // initialize the connection, close will close the connection, 
 // and channel will return the channel for reading or writing 
 // too.
+//
+// Open returns an error when the connection can not be made, 
+// in which case the connector must not be used.  The go routines 
+// behind the connector stop when the context given to Open is 
+// done or when Close is called, Close waits for them to stop.  A 
+// connector may be opened again once it has been closed.
 type Connector interface {
-	Open()
-	Close()
+	Open(ctx context.Context) error
+	Close() error
 	Channel() chan interface{} //chan []byte
 }
 
@@ -35,3 +53,118 @@ type Base struct {
 	core.Core
 	Channel_ chan interface{} //chan []byte
 }
+
+// Tracks a single life of a connector, from Open to Close, so 
+// the go routines behind it know when to stop and Close can 
+// wait for them.
+type lifecycle struct {
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	err    error
+}
+
+// Lets a func be closed along with a life.
+type closerFunc func() error
+
+func (f closerFunc) Close() error {
+	return f()
+}
+
+// Returns the error begin would return, allowing a connector 
+// to fail before it grabs any resources.
+func (l *lifecycle) check(parent context.Context) error {
+	if err := parent.Err(); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.cancel != nil {
+		return ErrAlreadyOpen
+	}
+
+	return nil
+}
+
+// Starts a new life bound to the parent context.  The closers 
+// are closed once the life is over which unblocks any go routine 
+// stuck reading or writing them.
+func (l *lifecycle) begin(parent context.Context, closers ...io.Closer) (context.Context, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	err := parent.Err()
+	if err == nil && l.cancel != nil {
+		err = ErrAlreadyOpen
+	}
+
+	if err != nil {
+		for _, c := range closers {
+			c.Close()
+		}
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(parent)
+	l.cancel = cancel
+	l.err = nil
+
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		<-ctx.Done()
+
+		for _, c := range closers {
+			if err := c.Close(); err != nil {
+				l.mu.Lock()
+				if l.err == nil {
+					l.err = err
+				}
+				l.mu.Unlock()
+			}
+		}
+	}()
+
+	return ctx, nil
+}
+
+// Runs f in a go routine that belongs to the current life.
+func (l *lifecycle) spawn(f func()) {
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		f()
+	}()
+}
+
+// Ends the current life and waits for its go routines to stop.  
+// Returns the first error from closing the closers.
+func (l *lifecycle) end() error {
+	l.mu.Lock()
+	cancel := l.cancel
+	l.cancel = nil
+	l.mu.Unlock()
+
+	if cancel == nil {
+		return ErrNotOpen
+	}
+
+	cancel()
+	l.wg.Wait()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
+
+// Reports if the done chan of a connector has been closed.
+func closed(done <-chan struct{}) bool {
+	select {
+	case <-done:
+		return true
+	default:
+		return false
+	}
+}
@@ -1,6 +1,12 @@
 package connector
 
 import (
+	"bytes"
+	"context"
+	"net"
+	"os"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 	"github.com/go-emd/emd/core"
@@ -12,84 +18,781 @@ func TestLocal(t *testing.T) {
 	log.Init(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
 
 	mylocal := &Local{
-		Base{
-			core.Core{"Test"},
+		Base: Base{
+			core.Core{Name_: "Test"},
 			make(chan interface{}, 0),
 		},
 	}
 
+	sent := make(chan bool)
+	received := make(chan bool)
+
 	// Sender
 	go func() {
-		mylocal.Open()
+		defer close(sent)
+
+		mylocal.Open(context.Background())
 		mylocal.Channel() <- "HEY"
 		mylocal.Close()
 	}()
 
 	// Receiver
 	go func() {
-		mylocal.Open()
+		defer close(received)
+
+		mylocal.Open(context.Background())
 
 		select {
 		case <- time.After(time.Second * 2):
-			t.Fail()
+			t.Error("timed out waiting for data")
 		case data := <- mylocal.Channel():
 			if data != "HEY" {
-				t.Fail()
+				t.Error("unexpected data", data)
 			}
 		}
 
 		mylocal.Close()
 	}()
+
+	<- received
+	<- sent
 }
 
 func TestExternalUDP(t *testing.T) {
 	log.Init(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
 
 	myexternalIngress := &ExternalUDPIngress{
-		External{
-			Base{
-				core.Core{"Test"},
+		External: External{
+			Base: Base{
+				core.Core{Name_: "Test"},
 				make(chan interface{}, 0),
 			},
-			"localhost",
-			"60000",
+			Host: "localhost",
+			Port: "60000",
 		},
-		Udp{nil},
-		nil,
 	}
 
 	myexternalEgress := &ExternalUDPEgress{
-		External{
-			Base{
-				core.Core{"Test"},
+		External: External{
+			Base: Base{
+				core.Core{Name_: "Test"},
 				make(chan interface{}, 0),
 			},
-			"localhost",
-			"60000",
+			Host: "localhost",
+			Port: "60000",
 		},
-		Udp{nil},
 	}
 
+	// The receiver has to be listening before anything 
+	// is sent since UDP does not wait for it.
+	myexternalIngress.Open(context.Background())
+	defer myexternalIngress.Close()
+
+	sent := make(chan bool)
+	received := make(chan bool)
+
 	// Sender
 	go func() {
-		myexternalEgress.Open()
+		defer close(sent)
+
+		myexternalEgress.Open(context.Background())
 		myexternalEgress.Channel() <- "HEY"
 		myexternalEgress.Close()
 	}()
 
 	// Receiver
 	go func() {
-		myexternalIngress.Open()
+		defer close(received)
 
 		select {
 		case <- time.After(time.Second * 2):
-			t.Fail()
+			t.Error("timed out waiting for data")
 		case data := <- myexternalIngress.Channel():
 			if data != "HEY" {
-				t.Fail()
+				t.Error("unexpected data", data)
 			}
 		}
+	}()
+
+	<- received
+	<- sent
+}
+
+func TestExternalTCP(t *testing.T) {
+	log.Init(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
+
+	myexternalIngress := &ExternalTCPIngress{
+		External: External{
+			Base: Base{
+				core.Core{Name_: "Test"},
+				make(chan interface{}, 0),
+			},
+			Host: "localhost",
+			Port: "60001",
+		},
+	}
+
+	myexternalEgress := &ExternalTCPEgress{
+		External: External{
+			Base: Base{
+				core.Core{Name_: "Test"},
+				make(chan interface{}, 0),
+			},
+			Host: "localhost",
+			Port: "60001",
+		},
+	}
+
+	// The sender is opened first so it has to keep
+	// trying until the receiver comes up.
+	myexternalEgress.Open(context.Background())
+	defer myexternalEgress.Close()
+
+	myexternalEgress.Channel() <- "HEY"
+
+	time.Sleep(streamMinBackoff)
+	myexternalIngress.Open(context.Background())
+
+	select {
+	case <- time.After(time.Second * 2):
+		t.Fatal("timed out waiting for data")
+	case data := <- myexternalIngress.Channel():
+		if data != "HEY" {
+			t.Fail()
+		}
+	}
+
+	// Restart the receiver, the sender should reconnect.
+	myexternalIngress.Close()
+	myexternalIngress.Open(context.Background())
+	defer myexternalIngress.Close()
 
-		myexternalIngress.Close()
+	// Stops sending once the test is over.
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		for i := 0; i < 10; i++ {
+			select {
+			case myexternalEgress.Channel() <- "AGAIN":
+			case <-done:
+				return
+			}
+		}
 	}()
+
+	select {
+	case <- time.After(time.Second * 5):
+		t.Fatal("timed out waiting for reconnect")
+	case data := <- myexternalIngress.Channel():
+		if data != "AGAIN" {
+			t.Fail()
+		}
+	}
+}
+
+func TestFrame(t *testing.T) {
+	msg := make([]byte, frameMaxPayload*3+10)
+	for i := range msg {
+		msg[i] = byte(i)
+	}
+
+	frames, err := fragment(frameData, 7, msg)
+	if err != nil || len(frames) != 4 {
+		t.Fatal("unexpected fragments", len(frames), err)
+	}
+
+	assembler := newReassembler()
+
+	// Out of order, with the first message missing a fragment.
+	lost, _ := fragment(frameData, 6, msg)
+	for _, f := range lost[1:] {
+		if _, ok := assembler.add("a", f); ok {
+			t.Fatal("incomplete message was reassembled")
+		}
+	}
+
+	for i := len(frames) - 1; i >= 0; i-- {
+		f, err := unmarshalFrame(frames[i].marshal())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		out, ok := assembler.add("a", f)
+		if ok != (i == 0) {
+			t.Fatal("reassembled at the wrong fragment", i)
+		}
+		if ok && !bytes.Equal(out, msg) {
+			t.Fatal("reassembled message differs")
+		}
+	}
+
+	if _, err := unmarshalFrame([]byte{frameVersion}); err != ErrFrameShort {
+		t.Fail()
+	}
+}
+
+func TestExternalUDPFragments(t *testing.T) {
+	log.Init(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
+
+	myexternalIngress := &ExternalUDPIngress{
+		External: External{
+			Base: Base{
+				core.Core{Name_: "Test"},
+				make(chan interface{}, 0),
+			},
+			Host: "localhost",
+			Port: "60002",
+		},
+	}
+
+	myexternalEgress := &ExternalUDPEgress{
+		External: External{
+			Base: Base{
+				core.Core{Name_: "Test"},
+				make(chan interface{}, 0),
+			},
+			Host: "localhost",
+			Port: "60002",
+		},
+	}
+
+	myexternalIngress.Open(context.Background())
+	defer myexternalIngress.Close()
+	myexternalEgress.Open(context.Background())
+	defer myexternalEgress.Close()
+
+	big := strings.Repeat("emd", 20000)
+	myexternalEgress.Channel() <- big
+	myexternalEgress.Channel() <- "HEY"
+
+	for _, want := range []string{big, "HEY"} {
+		select {
+		case <- time.After(time.Second * 2):
+			t.Fatal("timed out waiting for data")
+		case data := <- myexternalIngress.Channel():
+			if data != want {
+				t.Fail()
+			}
+		}
+	}
+}
+
+func TestDelivery(t *testing.T) {
+	w := newWindow()
+	w.Size = 2
+
+	w.add(1, "one")
+	w.add(0, "zero")
+	if !w.full() {
+		t.Fail()
+	}
+
+	due := w.due(0)
+	if len(due) != 2 || due[0] != "zero" || due[1] != "one" {
+		t.Fatal("unexpected due values", due)
+	}
+
+	w.ack(0)
+	if w.full() || len(w.due(time.Hour)) != 0 {
+		t.Fail()
+	}
+
+	d := newDedup()
+	if d.seen("a", 1) || !d.seen("a", 1) || d.seen("b", 1) {
+		t.Fail()
+	}
+}
+
+func TestExternalUDPAtLeastOnce(t *testing.T) {
+	log.Init(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
+
+	myexternalIngress := &ExternalUDPIngress{
+		External: External{
+			Base: Base{
+				core.Core{Name_: "Test"},
+				make(chan interface{}, 0),
+			},
+			Host: "localhost",
+			Port: "60003",
+			Delivery: AtLeastOnce,
+		},
+	}
+
+	myexternalEgress := &ExternalUDPEgress{
+		External: External{
+			Base: Base{
+				core.Core{Name_: "Test"},
+				make(chan interface{}, 0),
+			},
+			Host: "localhost",
+			Port: "60003",
+			Delivery: AtLeastOnce,
+		},
+	}
+
+	// Nobody is listening yet so the first send is lost 
+	// and has to be sent again.
+	myexternalEgress.Open(context.Background())
+	defer myexternalEgress.Close()
+	myexternalEgress.Channel() <- "HEY"
+
+	time.Sleep(deliveryTimeout)
+	myexternalIngress.Open(context.Background())
+	defer myexternalIngress.Close()
+
+	select {
+	case <- time.After(time.Second * 2):
+		t.Fatal("timed out waiting for data")
+	case data := <- myexternalIngress.Channel():
+		if data != "HEY" {
+			t.Fail()
+		}
+	}
+
+	// Once acked it must not be delivered again.
+	select {
+	case data := <- myexternalIngress.Channel():
+		t.Fatal("duplicate delivered", data)
+	case <- time.After(deliveryTimeout * 3):
+	}
+}
+
+func TestExternalTCPAtLeastOnce(t *testing.T) {
+	log.Init(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
+
+	myexternalIngress := &ExternalTCPIngress{
+		External: External{
+			Base: Base{
+				core.Core{Name_: "Test"},
+				make(chan interface{}, 0),
+			},
+			Host: "localhost",
+			Port: "60004",
+			Delivery: AtLeastOnce,
+		},
+	}
+
+	myexternalEgress := &ExternalTCPEgress{
+		External: External{
+			Base: Base{
+				core.Core{Name_: "Test"},
+				make(chan interface{}, 0),
+			},
+			Host: "localhost",
+			Port: "60004",
+			Delivery: AtLeastOnce,
+		},
+	}
+
+	myexternalIngress.Open(context.Background())
+	defer myexternalIngress.Close()
+	myexternalEgress.Open(context.Background())
+	defer myexternalEgress.Close()
+
+	for i := 0; i < 3; i++ {
+		myexternalEgress.Channel() <- i
+	}
+
+	for i := 0; i < 3; i++ {
+		select {
+		case <- time.After(time.Second * 2):
+			t.Fatal("timed out waiting for data")
+		case data := <- myexternalIngress.Channel():
+			if data != i {
+				t.Fatal("expected", i, "got", data)
+			}
+		}
+	}
+
+	select {
+	case data := <- myexternalIngress.Channel():
+		t.Fatal("duplicate delivered", data)
+	case <- time.After(deliveryTimeout * 3):
+	}
+}
+
+func TestCodec(t *testing.T) {
+	values := map[string]interface{}{
+		Gob:  "HEY",
+		JSON: map[string]interface{}{"HEY": 1.5},
+		Raw:  []byte("HEY"),
+	}
+
+	for name, v := range values {
+		codec := CodecByName(name)
+
+		var b bytes.Buffer
+		if err := codec.Encode(&b, v); err != nil {
+			t.Fatal(name, err)
+		}
+
+		out, err := codec.Decode(&b)
+		if err != nil {
+			t.Fatal(name, err)
+		}
+
+		if !reflect.DeepEqual(out, v) {
+			t.Error(name, "decoded", out, "expected", v)
+		}
+	}
+
+	if err := (RawCodec{}).Encode(ioutil.Discard, "HEY"); err != ErrRawType {
+		t.Fail()
+	}
+
+	if CodecByName("XML") != nil {
+		t.Fail()
+	}
+}
+
+func TestExternalTCPJSON(t *testing.T) {
+	log.Init(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
+
+	myexternalIngress := &ExternalTCPIngress{
+		External: External{
+			Base: Base{
+				core.Core{Name_: "Test"},
+				make(chan interface{}, 0),
+			},
+			Host: "localhost",
+			Port: "60005",
+			Codec: JSONCodec{},
+		},
+	}
+
+	myexternalIngress.Open(context.Background())
+	defer myexternalIngress.Close()
+
+	// Anything that speaks the envelope can send JSON in.
+	conn, err := net.Dial("tcp", "localhost:60005")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	err = envelope{1, 0, false, []byte(`{"HEY":[1,2]}`)}.writeTo(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <- time.After(time.Second * 2):
+		t.Fatal("timed out waiting for data")
+	case data := <- myexternalIngress.Channel():
+		expected := map[string]interface{}{"HEY": []interface{}{1.0, 2.0}}
+		if !reflect.DeepEqual(data, expected) {
+			t.Error("unexpected data", data)
+		}
+	}
+}
+
+func TestLifecycle(t *testing.T) {
+	log.Init(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
+
+	newIngress := func() *ExternalUDPIngress {
+		return &ExternalUDPIngress{
+			External: External{
+				Base: Base{
+					core.Core{Name_: "Test"},
+					make(chan interface{}, 0),
+				},
+				Host: "localhost",
+				Port: "60006",
+			},
+		}
+	}
+
+	first, second := newIngress(), newIngress()
+
+	if err := first.Open(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := first.Open(context.Background()); err != ErrAlreadyOpen {
+		t.Error("expected ErrAlreadyOpen got", err)
+	}
+
+	// The port is taken so this has to fail rather than 
+	// carry on without a connection.
+	if err := second.Open(context.Background()); err == nil {
+		t.Error("expected second open on the same port to fail")
+	}
+
+	if err := first.Close(); err != nil {
+		t.Error(err)
+	}
+
+	if err := first.Close(); err != ErrNotOpen {
+		t.Error("expected ErrNotOpen got", err)
+	}
+
+	// Close really let go of the port.
+	if err := second.Open(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Cancelling the context stops the connector as well.
+	ctx, cancel := context.WithCancel(context.Background())
+	egress := &ExternalTCPEgress{
+		External: External{
+			Base: Base{
+				core.Core{Name_: "Test"},
+				make(chan interface{}, 0),
+			},
+			Host: "localhost",
+			Port: "60007",
+		},
+	}
+
+	if err := egress.Open(ctx); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	time.Sleep(streamMinBackoff)
+
+	select {
+	case egress.Channel() <- "HEY":
+		t.Error("egress still running after its context was cancelled")
+	case <- time.After(streamMinBackoff):
+	}
+
+	if err := egress.Close(); err != nil {
+		t.Error(err)
+	}
+
+	if err := second.Close(); err != nil {
+		t.Error(err)
+	}
+
+	if err := second.Open(ctx); err != context.Canceled {
+		t.Error("expected context.Canceled got", err)
+	}
+}
+
+func TestExternalUnix(t *testing.T) {
+	log.Init(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
+
+	myexternalIngress := &ExternalUnixIngress{
+		External: External{
+			Base: Base{
+				core.Core{Name_: "TestUnix"},
+				make(chan interface{}, 0),
+			},
+		},
+	}
+
+	myexternalEgress := &ExternalUnixEgress{
+		External: External{
+			Base: Base{
+				core.Core{Name_: "TestUnix"},
+				make(chan interface{}, 0),
+			},
+			Delivery: AtLeastOnce,
+		},
+	}
+
+	// A stale socket file left behind is replaced.
+	os.WriteFile(SocketPath("TestUnix"), nil, 0600)
+
+	if err := myexternalIngress.Open(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer myexternalIngress.Close()
+
+	// But a live one is not.
+	other := &ExternalUnixIngress{Path: SocketPath("TestUnix")}
+	if err := other.Open(context.Background()); err != ErrSocketInUse {
+		t.Error("expected ErrSocketInUse got", err)
+	}
+
+	if err := myexternalEgress.Open(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer myexternalEgress.Close()
+
+	myexternalEgress.Channel() <- "HEY"
+
+	select {
+	case <- time.After(time.Second * 2):
+		t.Fatal("timed out waiting for data")
+	case data := <- myexternalIngress.Channel():
+		if data != "HEY" {
+			t.Fail()
+		}
+	}
+}
+
+func TestStats(t *testing.T) {
+	log.Init(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
+
+	myexternalIngress := &ExternalTCPIngress{
+		External: External{
+			Base: Base{
+				core.Core{Name_: "Test"},
+				make(chan interface{}, 0),
+			},
+			Host: "localhost",
+			Port: "60008",
+		},
+	}
+
+	myexternalEgress := &ExternalTCPEgress{
+		External: External{
+			Base: Base{
+				core.Core{Name_: "Test"},
+				make(chan interface{}, 0),
+			},
+			Host: "localhost",
+			Port: "60008",
+		},
+	}
+
+	myexternalIngress.Open(context.Background())
+	defer myexternalIngress.Close()
+	myexternalEgress.Open(context.Background())
+	defer myexternalEgress.Close()
+
+	// A chan can not be encoded.
+	myexternalEgress.Channel() <- make(chan int)
+	myexternalEgress.Channel() <- "HEY"
+
+	select {
+	case <- time.After(time.Second * 2):
+		t.Fatal("timed out waiting for data")
+	case <- myexternalIngress.Channel():
+	}
+
+	// The egress counts the value once its write returns.
+	waitFor(t, func() bool { return myexternalEgress.Stats().Sent == 1 })
+
+	in, out := myexternalIngress.Stats(), myexternalEgress.Stats()
+	if out.EncodeErrors != 1 || out.BytesSent == 0 || out.BytesSent != in.BytesReceived {
+		t.Error("unexpected egress stats", out, in)
+	}
+
+	if in.Received != 1 || in.Sent != 0 || in.Dropped != 0 || in.DecodeErrors != 0 {
+		t.Error("unexpected ingress stats", in)
+	}
+
+	myudp := &ExternalUDPIngress{
+		External: External{
+			Base: Base{
+				core.Core{Name_: "Test"},
+				make(chan interface{}, 0),
+			},
+			Port: "60009",
+		},
+	}
+
+	myudp.Open(context.Background())
+	defer myudp.Close()
+
+	conn, err := net.Dial("udp", "localhost:60009")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Neither a frame nor a value.
+	garbage := frame{frameData, 0, 1, 1, []byte("garbage")}.marshal()
+	conn.Write([]byte("garbage"))
+	conn.Write(garbage)
+
+	waitFor(t, func() bool { return myudp.Stats().DecodeErrors == 1 })
+
+	if s := myudp.Stats(); s.Dropped != 1 || s.Received != 0 || s.BytesReceived != uint64(len("garbage")+len(garbage)) {
+		t.Error("unexpected udp stats", s)
+	}
+
+	mylocal := &Local{
+		Base: Base{
+			core.Core{Name_: "Test"},
+			make(chan interface{}, 2),
+		},
+	}
+	mylocal.Channel() <- "HEY"
+
+	if s := StatsOf(mylocal); s.Length != 1 || s.Capacity != 2 || s.Sent != 0 {
+		t.Error("unexpected local stats", s)
+	}
+
+	// The ends of a NewLocal connection count what goes across.
+	egress, ingress := NewLocal("Out", "In", 2)
+	if err := ingress.Open(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	egress.Channel() <- "HEY"
+	egress.Channel() <- "HO"
+	if <-ingress.Channel() != "HEY" || <-ingress.Channel() != "HO" {
+		t.Error("values did not go across")
+	}
+
+	waitFor(t, func() bool { return ingress.Stats().Received == 2 })
+
+	if s := egress.Stats(); s.Sent != 2 || s.Received != 0 || s.Capacity != 2 {
+		t.Error("unexpected egress stats", s)
+	}
+
+	// A value taken across but not read yet is kept when the 
+	// ingress is closed.
+	egress.Channel() <- "PENDING"
+	waitFor(t, func() bool { return egress.Stats().Sent == 3 })
+
+	if err := ingress.Close(); err != nil {
+		t.Error(err)
+	}
+
+	// Nothing goes across once the ingress is closed.
+	egress.Channel() <- "KEPT"
+	if s := ingress.Stats(); s.Received != 2 || egress.Stats().Length != 1 {
+		t.Error("unexpected stats once closed", s, egress.Stats())
+	}
+
+	if err := ingress.Close(); err != ErrNotOpen {
+		t.Error("closed twice", err)
+	}
+
+	if err := ingress.Open(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer ingress.Close()
+
+	if <-ingress.Channel() != "PENDING" || <-ingress.Channel() != "KEPT" {
+		t.Error("values were lost across a Close")
+	}
+
+	waitFor(t, func() bool { return ingress.Stats().Received == 4 })
+
+	if s := ingress.Stats(); s.Dropped != 0 {
+		t.Error("unexpected stats once opened again", s)
+	}
+
+	// The receiving worker of a shared Local is given an ingress.
+	shared := &Local{Base: Base{Core: core.Core{Name_: "Shared"}, Channel_: make(chan interface{}, 1)}}
+	reader := shared.Ingress("Shared")
+	if err := reader.Open(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	shared.Channel() <- "HEY"
+	if <-reader.Channel() != "HEY" {
+		t.Error("value did not go across")
+	}
+
+	waitFor(t, func() bool { return reader.Stats().Received == 1 && shared.Stats().Sent == 1 })
+}
+
+// Waits up to two seconds for the condition to hold.
+func waitFor(t *testing.T, condition func() bool) {
+	deadline := time.Now().Add(time.Second * 2)
+
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the condition")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
 }
@@ -0,0 +1,151 @@
+package connector
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The delivery modes an external connector can run in.  An
+// AtMostOnce connector sends each value once and forgets about it
+// (the default), an AtLeastOnce connector keeps every value until
+// the ingress acknowledges it and sends it again on timeout.  The
+// ingress drops the duplicates this may cause.
+const (
+	AtMostOnce  = "AtMostOnce"
+	AtLeastOnce = "AtLeastOnce"
+)
+
+// The tuning of the AtLeastOnce delivery mode.  The window is how
+// many values may be unacknowledged before the egress stops taking
+// new values off its channel, the timeout is how long a value waits
+// for its ack before it is sent again, and the history is how many
+// sequence numbers per sender the ingress remembers for dropping
+// duplicates.
+var (
+	deliveryWindow  = 64
+	deliveryTimeout = time.Millisecond * 250
+	deliveryHistory = 1024
+)
+
+// Returns true if the connector should run with acknowledgements.
+func (e *External) reliable() bool {
+	return e.Delivery == AtLeastOnce
+}
+
+// A value that is waiting to be acknowledged.
+type inflight struct {
+	Value interface{}
+	Sent  time.Time
+}
+
+// The bounded set of values an AtLeastOnce egress has sent but
+// not yet had acknowledged, keyed by sequence number.
+type window struct {
+	Size    int
+	pending map[uint64]*inflight
+}
+
+// Creates a window of the default size.
+func newWindow() *window {
+	return &window{
+		Size:    deliveryWindow,
+		pending: make(map[uint64]*inflight),
+	}
+}
+
+// Returns true if no more values may be sent until one is acked.
+func (w *window) full() bool {
+	return len(w.pending) >= w.Size
+}
+
+// Records a value that was just sent.
+func (w *window) add(seq uint64, value interface{}) {
+	w.pending[seq] = &inflight{value, time.Now()}
+}
+
+// Forgets a value once it has been acknowledged.
+func (w *window) ack(seq uint64) {
+	delete(w.pending, seq)
+}
+
+// Returns the values that waited longer than the timeout in
+// sequence order and marks them as sent again.
+func (w *window) due(timeout time.Duration) []interface{} {
+	now := time.Now()
+
+	var seqs []uint64
+	for seq, v := range w.pending {
+		if now.Sub(v.Sent) >= timeout {
+			seqs = append(seqs, seq)
+		}
+	}
+
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+
+	values := make([]interface{}, len(seqs))
+	for i, seq := range seqs {
+		values[i] = w.pending[seq].Value
+		w.pending[seq].Sent = now
+	}
+
+	return values
+}
+
+// Remembers the most recent sequence numbers received from each
+// sender so an ingress can drop values that were sent twice.
+type dedup struct {
+	mu      sync.Mutex
+	senders map[string]*history
+}
+
+// The sequence numbers seen from one sender, oldest first.
+type history struct {
+	Seen  map[uint64]bool
+	Order []uint64
+}
+
+// Creates an empty dedup.
+func newDedup() *dedup {
+	return &dedup{senders: make(map[string]*history)}
+}
+
+// Records the sequence number from the sender and reports if it
+// had already been seen.
+func (d *dedup) seen(from string, seq uint64) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	h, ok := d.senders[from]
+	if !ok {
+		if len(d.senders) >= deliveryWindow {
+			for k := range d.senders {
+				delete(d.senders, k)
+				break
+			}
+		}
+
+		h = &history{Seen: make(map[uint64]bool)}
+		d.senders[from] = h
+	}
+
+	if h.Seen[seq] {
+		return true
+	}
+
+	h.Seen[seq] = true
+	h.Order = append(h.Order, seq)
+
+	if len(h.Order) > deliveryHistory {
+		delete(h.Seen, h.Order[0])
+		h.Order = h.Order[1:]
+	}
+
+	return false
+}
+
+// Identifies an egress across reconnects for the dedup.
+func sessionKey(session uint64) string {
+	return strconv.FormatUint(session, 16)
+}
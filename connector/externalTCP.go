@@ -0,0 +1,99 @@
+package connector
+
+import (
+	"github.com/go-emd/emd/log"
+	"context"
+	"encoding/gob"
+	"net"
+)
+
+// Inherits the connector.External struct and listens for
+// ExternalTCPEgress connectors to connect to it.  Unlike
+// the ExternalUDPIngress every value arrives in order and
+// is not lost while the connection is up.  When the other
+// leader restarts it will simply connect again.
+//
+// Values are decoded with the connector's Codec, the GobCodec
+// by default, in which case the types being sent must be
+// registered using the connector.ExternalTCPIngress.Register
+// function.
+type ExternalTCPIngress struct {
+	External
+	streamIngress
+}
+
+// Registers the type to be decoded from the connector.ExternalTCPEgress data
+// that was serialized.
+func (e *ExternalTCPIngress) Register(t interface{}) {
+	gob.Register(t)
+}
+
+// Returns the underlying channel to read from.
+func (e *ExternalTCPIngress) Channel() chan interface{} {
+	return e.Channel_
+}
+
+// Opens the specified port to listen on for incoming streams
+// of envelopes.
+func (e *ExternalTCPIngress) Open(ctx context.Context) error {
+	if err := e.life.check(ctx); err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("tcp", ":"+e.Port)
+	if err != nil {
+		log.ERROR.Println(err)
+		return err
+	}
+
+	if err := e.open(ctx, &e.External, listener); err != nil {
+		return err
+	}
+
+	log.INFO.Println("ExternalTCPIngress: connector " + e.Name_ + " is opened.")
+	return nil
+}
+
+// Stops listening, closes every connection that is open and
+// waits for the go routines reading them to stop.
+func (e *ExternalTCPIngress) Close() error {
+	err := e.life.end()
+	log.INFO.Println("ExternalTCPIngress: connector " + e.Name_ + " is closed.")
+	return err
+}
+
+// Client
+
+// The base constructor of the ExternalTCPEgress connector implementation.
+// It's purpose is to send encoded data over a persistent connection
+// to the specified host:port, reconnecting when the connection drops.
+//
+// Values written just before a connection drops can still be lost,
+// run the connector AtLeastOnce when that matters.
+type ExternalTCPEgress struct {
+	External
+	streamEgress
+}
+
+// Returns the base channel used under the hood.
+func (e *ExternalTCPEgress) Channel() chan interface{} {
+	return e.Channel_
+}
+
+// Begins forwarding encoded data to the specified host:port.
+func (e *ExternalTCPEgress) Open(ctx context.Context) error {
+	if err := e.open(ctx, &e.External, "tcp", e.Host+":"+e.Port); err != nil {
+		return err
+	}
+
+	log.INFO.Println("ExternalTCPEgress: connector " + e.Name_ + " is opened.")
+	return nil
+}
+
+// Closes the host:port connection that was created and waits
+// for the go routines using it to stop.
+func (e *ExternalTCPEgress) Close() error {
+	err := e.life.end()
+	log.INFO.Println("ExternalTCPEgress: connector " + e.Name_ + " is closed.")
+	return err
+}
@@ -2,8 +2,12 @@ package connector
 
 import (
 	"github.com/go-emd/emd/log"
+	"bytes"
+	"context"
 	"encoding/gob"
+	"errors"
 	"net"
+	"time"
 )
 
 // This must be inherited by all other 
@@ -14,28 +18,45 @@ import (
 // It will hold extra important information 
 // that all external connector implementations 
 // require such as the host and port that that 
-// the other worker is on.
+// the other worker is on, the delivery mode 
+// (AtMostOnce when left empty, or AtLeastOnce) and 
+// the Codec values are sent with (GobCodec when nil).
+//
+// Every external connector counts the values and bytes 
+// passing through it, see Stats.
 type External struct {
 	Base
-	Host string
-	Port string
+	Host     string
+	Port     string
+	Delivery string
+	Codec    Codec
+	counters counters
+}
+
+// Returns the traffic the connector has seen so far.
+func (e *External) Stats() Stats {
+	return e.counters.stats(e.Channel_)
 }
 
 // Simply hold UDP specific information in order 
 // to maintain a UDP connection.
 type Udp struct {
 	Conn *net.UDPConn
+	life lifecycle
 }
 
 // Inherits the connector.External struct and 
 // connector.External struct and adding the Buf 
 // of type interface {}.  The Buf is very important 
 // because the ExternalUDP connections use encoding/gob 
-// to communicate reliably and with minimal bytes transferred.
+// by default to communicate with minimal bytes transferred.
+// Each value is sent framed (see frame.go) so a value may span 
+// many datagrams and a lost datagram only loses its own value.
 // 
 // The Buf interface is registered using the connector.ExternalUDPIngress.Register 
 // function which will register the type that needs to be decoded with gob 
-// allowing it to be deserialized and received over the wire.
+// allowing it to be deserialized and received over the wire.  Other 
+// codecs such as the JSONCodec do not need types registered.
 type ExternalUDPIngress struct {
 	External
 	Udp
@@ -44,7 +65,7 @@ type ExternalUDPIngress struct {
 
 // Registers the type to be decoded from the connector.ExternalUDPEgress data 
 // that was serialized.
-func (e ExternalUDPIngress) Register(t interface{}) {
+func (e *ExternalUDPIngress) Register(t interface{}) {
 	gob.Register(t)
 	e.Buf = t
 }
@@ -55,40 +76,118 @@ func (e *ExternalUDPIngress) Channel() chan interface{} {
 }
 
 // Opens the specified port to listen on for incoming gob 
-// encoded data.
-func (e *ExternalUDPIngress) Open() {
+// encoded data and reassembles the framed values.
+func (e *ExternalUDPIngress) Open(ctx context.Context) error {
+	if err := e.life.check(ctx); err != nil {
+		return err
+	}
+
 	addr, err := net.ResolveUDPAddr("udp", ":"+e.Port)
 	if err != nil {
 		log.ERROR.Println(err)
+		return err
 	}
 
-	e.Conn, err = net.ListenUDP("udp", addr)
+	conn, err := net.ListenUDP("udp", addr)
 	if err != nil {
 		log.ERROR.Println(err)
+		return err
 	}
 
-	go func(channel chan<- interface{}) {
-		defer e.Conn.Close()
-		decoder := gob.NewDecoder(e.Conn)
+	ctx, err = e.life.begin(ctx, conn)
+	if err != nil {
+		return err
+	}
 
-		for {
-			err := decoder.Decode(&e.Buf)
-			if err != nil {
+	e.Conn = conn
+	e.life.spawn(func() { e.receive(ctx, conn, e.Channel_) })
+
+	log.INFO.Println("ExternalUDPIngress: connector " + e.Name_ + " is opened.")
+	return nil
+}
+
+// Reads datagrams until the connection is closed, forwarding 
+// every value once all of its fragments have arrived.
+func (e *ExternalUDPIngress) receive(ctx context.Context, conn *net.UDPConn, channel chan<- interface{}) {
+	assembler := newReassembler()
+	assembler.drop = e.counters.drop
+	received := newDedup()
+	codec := e.codec()
+	buf := make([]byte, frameMaxDatagram)
+
+	for {
+		n, addr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if ctx.Err() == nil {
 				log.ERROR.Println(err)
 			}
+			return
+		}
+
+		e.counters.read(n)
 
-			channel <- e.Buf
+		f, err := unmarshalFrame(buf[:n])
+		if err != nil {
+			log.WARNING.Println(err)
+			e.counters.drop()
+			continue
 		}
-	}(e.Channel_)
 
-	log.INFO.Println("ExternalUDPIngress: connector " + e.Name_ + " is opened.")
+		if f.Kind != frameData && f.Kind != frameReliable {
+			continue
+		}
+
+		msg, ok := assembler.add(addr.String(), f)
+		if !ok {
+			continue
+		}
+
+		// The ack of a value seen before was lost, 
+		// send it again but drop the duplicate.
+		if f.Kind == frameReliable && received.seen(addr.String(), f.Seq) {
+			ack(conn, addr, f.Seq)
+			e.counters.drop()
+			continue
+		}
+
+		// Every value is decoded on its own since 
+		// each one is encoded on its own.
+		e.Buf, err = codec.Decode(bytes.NewReader(msg))
+		if err != nil {
+			log.ERROR.Println(err)
+			e.counters.decodeError()
+			continue
+		}
+
+		select {
+		case channel <- e.Buf:
+			e.counters.receive()
+		case <-ctx.Done():
+			return
+		}
+
+		if f.Kind == frameReliable {
+			ack(conn, addr, f.Seq)
+		}
+	}
 }
 
-// Closes the UDP port being listened on.
-func (e *ExternalUDPIngress) Close() {
-	//e.Conn.Close() // Only in TCP
+// Acknowledges a frameReliable value once it has been handed to 
+// the channel.
+func ack(conn *net.UDPConn, addr *net.UDPAddr, seq uint64) {
+	_, err := conn.WriteToUDP(frame{frameAck, 0, 1, seq, nil}.marshal(), addr)
+	if err != nil {
+		log.WARNING.Println(err)
+	}
+}
+
+// Closes the UDP port being listened on and waits for the 
+// go routine reading it to stop.
+func (e *ExternalUDPIngress) Close() error {
 	//close(e.Channel) // Will be garbage collected
+	err := e.life.end()
 	log.INFO.Println("ExternalUDPIngress: connector " + e.Name_ + " is closed.")
+	return err
 }
 
 // Client
@@ -106,39 +205,165 @@ func (e *ExternalUDPEgress) Channel() chan interface{} {
 }
 
 // Sets up a connection to the specified host:port 
-// and begins forwarding gob encoded data to it.
-func (e *ExternalUDPEgress) Open() {
+// and begins forwarding gob encoded data to it one 
+// framed value at a time.  When running AtLeastOnce 
+// each value is kept until it is acknowledged and no 
+// new values are taken while the window is full.
+func (e *ExternalUDPEgress) Open(ctx context.Context) error {
+	if err := e.life.check(ctx); err != nil {
+		return err
+	}
+
 	addr, err := net.ResolveUDPAddr("udp", e.Host+":"+e.Port)
 	if err != nil {
 		log.ERROR.Println(err)
+		return err
 	}
 
-	e.Conn, err = net.DialUDP("udp", nil, addr)
+	conn, err := net.DialUDP("udp", nil, addr)
 	if err != nil {
 		log.ERROR.Println(err)
+		return err
+	}
+
+	ctx, err = e.life.begin(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	e.Conn = conn
+	e.life.spawn(func() { e.send(ctx, conn, e.Channel_) })
+
+	log.INFO.Println("ExternalUDPEgress: connector " + e.Name_ + " is opened.")
+	return nil
+}
+
+// Encodes everything from the channel and writes it to the 
+// connection until the connector is closed.
+func (e *ExternalUDPEgress) send(ctx context.Context, conn *net.UDPConn, channel <-chan interface{}) {
+	var seq uint64
+	var inflight *window
+	var acks chan uint64
+	var retry <-chan time.Time
+
+	codec := e.codec()
+	kind := uint8(frameData)
+	if e.reliable() {
+		kind = frameReliable
+		inflight = newWindow()
+		acks = make(chan uint64)
+		e.life.spawn(func() { receiveDatagramAcks(ctx, conn, acks) })
+
+		ticker := time.NewTicker(deliveryTimeout / 2)
+		defer ticker.Stop()
+		retry = ticker.C
 	}
 
-	go func(channel <-chan interface{}) {
-		defer e.Conn.Close()
-		encoder := gob.NewEncoder(e.Conn)
-
-		for {
-			select {
-			case data := <-channel:
-				err := encoder.Encode(&data)
-				if err != nil {
-					log.ERROR.Println(err)
-				}
+	for {
+		input := channel
+		if inflight != nil && inflight.full() {
+			input = nil
+		}
+
+		select {
+		case data := <-input:
+			var msg bytes.Buffer
+
+			err := codec.Encode(&msg, data)
+			if err != nil {
+				log.ERROR.Println(err)
+				e.counters.encodeError()
+				continue
+			}
+
+			frames, err := fragment(kind, seq, msg.Bytes())
+			if err != nil {
+				log.ERROR.Println(err)
+				e.counters.drop()
+				continue
+			}
+
+			datagrams := make([][]byte, len(frames))
+			for i, f := range frames {
+				datagrams[i] = f.marshal()
 			}
+
+			if inflight != nil {
+				inflight.add(seq, datagrams)
+			}
+			seq += 1
+
+			// A value that is not kept for a retry is lost 
+			// when it can not be written.
+			n, err := write(conn, datagrams)
+			if err == nil {
+				e.counters.send(n)
+			} else if inflight == nil {
+				e.counters.drop()
+			}
+		case s := <-acks:
+			inflight.ack(s)
+		case <-retry:
+			for _, datagrams := range inflight.due(deliveryTimeout) {
+				n, _ := write(conn, datagrams.([][]byte))
+				e.counters.resend(n)
+			}
+		case <-ctx.Done():
+			return
 		}
-	}(e.Channel_)
+	}
+}
 
-	log.INFO.Println("ExternalUDPEgress: connector " + e.Name_ + " is opened.")
+// Writes the datagrams of one value.  Returns the bytes 
+// written and the error that stopped the writing.
+func write(conn *net.UDPConn, datagrams [][]byte) (int, error) {
+	var written int
+
+	for _, d := range datagrams {
+		n, err := conn.Write(d)
+		written += n
+		if err != nil {
+			log.ERROR.Println(err)
+			return written, err
+		}
+	}
+
+	return written, nil
+}
+
+// Reads the acks sent back by the ingress.  Errors caused by the 
+// other side not listening yet are ignored since those values will 
+// simply be sent again.
+func receiveDatagramAcks(ctx context.Context, conn *net.UDPConn, acks chan<- uint64) {
+	buf := make([]byte, frameMaxDatagram)
+
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+
+		f, err := unmarshalFrame(buf[:n])
+		if err != nil || f.Kind != frameAck {
+			continue
+		}
+
+		select {
+		case acks <- f.Seq:
+		case <-ctx.Done():
+			return
+		}
+	}
 }
 
-// Closes the host:port connection that was created.
-func (e *ExternalUDPEgress) Close() {
-	//e.Conn.Close() // Only in TCP
+// Closes the host:port connection that was created and 
+// waits for the go routines using it to stop.
+func (e *ExternalUDPEgress) Close() error {
 	//close(e.Channel) // Will be garbage collected
+	err := e.life.end()
 	log.INFO.Println("ExternalUDPEgress: connector " + e.Name_ + " is closed.")
+	return err
 }
@@ -0,0 +1,129 @@
+package connector
+
+import (
+	"github.com/go-emd/emd/log"
+	"context"
+	"encoding/gob"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+)
+
+// Returned when an ExternalUnixIngress finds another process
+// already listening on its socket.
+var ErrSocketInUse = errors.New("connector: unix socket already in use")
+
+// Returns the socket path both ends of a unix connection
+// use when none is given.  It is derived from the alias of
+// the connection so the two leaders agree on it.
+func SocketPath(alias string) string {
+	return filepath.Join(os.TempDir(), "emd_"+alias+".sock")
+}
+
+// Returns the socket the connector should use, the Path if
+// it is set or the SocketPath of the connector name.
+func socketPath(path, name string) string {
+	if path != "" {
+		return path
+	}
+
+	return SocketPath(name)
+}
+
+// Inherits the connector.External struct and listens on a
+// unix domain socket for ExternalUnixEgress connectors on
+// the same host.  It behaves just like the ExternalTCPIngress,
+// including the delivery modes and codecs, without going
+// through the network stack.  The Host and Port are unused.
+type ExternalUnixIngress struct {
+	External
+	streamIngress
+	Path string
+}
+
+// Registers the type to be decoded from the connector.ExternalUnixEgress data
+// that was serialized.
+func (e *ExternalUnixIngress) Register(t interface{}) {
+	gob.Register(t)
+}
+
+// Returns the underlying channel to read from.
+func (e *ExternalUnixIngress) Channel() chan interface{} {
+	return e.Channel_
+}
+
+// Listens on the socket, replacing the socket file a crashed
+// leader may have left behind.
+func (e *ExternalUnixIngress) Open(ctx context.Context) error {
+	if err := e.life.check(ctx); err != nil {
+		return err
+	}
+
+	path := socketPath(e.Path, e.Name_)
+
+	if _, err := os.Stat(path); err == nil {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			log.ERROR.Println(ErrSocketInUse)
+			return ErrSocketInUse
+		}
+
+		os.Remove(path)
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		log.ERROR.Println(err)
+		return err
+	}
+
+	if err := e.open(ctx, &e.External, listener); err != nil {
+		return err
+	}
+
+	log.INFO.Println("ExternalUnixIngress: connector " + e.Name_ + " is opened.")
+	return nil
+}
+
+// Stops listening, which removes the socket file, and closes
+// every connection that is open.
+func (e *ExternalUnixIngress) Close() error {
+	err := e.life.end()
+	log.INFO.Println("ExternalUnixIngress: connector " + e.Name_ + " is closed.")
+	return err
+}
+
+// Client
+
+// The base constructor of the ExternalUnixEgress connector implementation.
+// It's purpose is to send encoded data over a unix domain socket to an
+// ExternalUnixIngress on the same host, reconnecting when it restarts.
+type ExternalUnixEgress struct {
+	External
+	streamEgress
+	Path string
+}
+
+// Returns the base channel used under the hood.
+func (e *ExternalUnixEgress) Channel() chan interface{} {
+	return e.Channel_
+}
+
+// Begins forwarding encoded data to the socket.
+func (e *ExternalUnixEgress) Open(ctx context.Context) error {
+	if err := e.open(ctx, &e.External, "unix", socketPath(e.Path, e.Name_)); err != nil {
+		return err
+	}
+
+	log.INFO.Println("ExternalUnixEgress: connector " + e.Name_ + " is opened.")
+	return nil
+}
+
+// Closes the connection to the socket and waits for the go
+// routines using it to stop.
+func (e *ExternalUnixEgress) Close() error {
+	err := e.life.end()
+	log.INFO.Println("ExternalUnixEgress: connector " + e.Name_ + " is closed.")
+	return err
+}
@@ -0,0 +1,219 @@
+package connector
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// The ExternalUDP connectors send every message inside a frame.  A
+// message is encoded on its own, so it never depends on a datagram
+// that came before it, and then split into as many fragments as it
+// takes to fit each one into a single datagram.  Every fragment is
+// sent with this header in front of its payload:
+//
+//	version uint8   always frameVersion
+//	kind    uint8   frameData, frameReliable or frameAck
+//	index   uint16  position of this fragment in the message
+//	count   uint16  number of fragments in the message
+//	seq     uint64  sequence number of the message
+//
+// A lost or reordered datagram therefore only costs the message it
+// belonged to.  A frameReliable message is acknowledged by the
+// receiver with a frameAck that carries the same seq and no payload.
+const (
+	frameVersion     = 1
+	frameData        = 1
+	frameReliable    = 2
+	frameAck         = 3
+	frameHeaderSize  = 14
+	frameMaxPayload  = 1200
+	frameMaxDatagram = 65507
+)
+
+// The errors returned when a datagram or message can not be framed.
+var (
+	ErrFrameShort   = errors.New("frame: datagram shorter than header")
+	ErrFrameVersion = errors.New("frame: unknown version")
+	ErrFrameIndex   = errors.New("frame: fragment index out of range")
+	ErrFrameSize    = errors.New("frame: message too large to fragment")
+)
+
+// A single fragment of a message as it is sent over the wire.
+type frame struct {
+	Kind    uint8
+	Index   uint16
+	Count   uint16
+	Seq     uint64
+	Payload []byte
+}
+
+// Serializes the frame header followed by its payload.
+func (f frame) marshal() []byte {
+	b := make([]byte, frameHeaderSize+len(f.Payload))
+
+	b[0] = frameVersion
+	b[1] = f.Kind
+	binary.BigEndian.PutUint16(b[2:], f.Index)
+	binary.BigEndian.PutUint16(b[4:], f.Count)
+	binary.BigEndian.PutUint64(b[6:], f.Seq)
+	copy(b[frameHeaderSize:], f.Payload)
+
+	return b
+}
+
+// Parses a datagram into a frame.  The payload is copied so the
+// datagram buffer can be reused by the caller.
+func unmarshalFrame(b []byte) (frame, error) {
+	var f frame
+
+	if len(b) < frameHeaderSize {
+		return f, ErrFrameShort
+	}
+
+	if b[0] != frameVersion {
+		return f, ErrFrameVersion
+	}
+
+	f.Kind = b[1]
+	f.Index = binary.BigEndian.Uint16(b[2:])
+	f.Count = binary.BigEndian.Uint16(b[4:])
+	f.Seq = binary.BigEndian.Uint64(b[6:])
+
+	if f.Index >= f.Count {
+		return f, ErrFrameIndex
+	}
+
+	f.Payload = append([]byte(nil), b[frameHeaderSize:]...)
+	return f, nil
+}
+
+// Splits an encoded message into the frames of the given kind
+// that carry it.
+func fragment(kind uint8, seq uint64, msg []byte) ([]frame, error) {
+	count := (len(msg) + frameMaxPayload - 1) / frameMaxPayload
+	if count == 0 {
+		count = 1
+	}
+
+	if count > 0xFFFF {
+		return nil, ErrFrameSize
+	}
+
+	frames := make([]frame, count)
+	for i := range frames {
+		start := i * frameMaxPayload
+		end := start + frameMaxPayload
+		if end > len(msg) {
+			end = len(msg)
+		}
+
+		frames[i] = frame{kind, uint16(i), uint16(count), seq, msg[start:end]}
+	}
+
+	return frames, nil
+}
+
+// Identifies a message by who sent it and its sequence number
+// since more than one egress connector may send to an ingress.
+type messageKey struct {
+	From string
+	Seq  uint64
+}
+
+// The fragments of a message received so far.
+type partial struct {
+	Parts    [][]byte
+	Received int
+	Started  time.Time
+}
+
+// Collects fragments until a whole message has arrived.  Messages
+// that are still incomplete after the timeout, or when too many are
+// pending at once, are dropped.
+type reassembler struct {
+	Timeout time.Duration
+	Limit   int
+	pending map[messageKey]*partial
+	drop    func() // Called for every message dropped, if set.
+}
+
+// Creates a reassembler with the default timeout and limit.
+func newReassembler() *reassembler {
+	return &reassembler{
+		Timeout: time.Second * 5,
+		Limit:   64,
+		pending: make(map[messageKey]*partial),
+	}
+}
+
+// Adds a fragment received from the given sender.  When it was the
+// last missing fragment of its message the reassembled message is
+// returned along with true.
+func (r *reassembler) add(from string, f frame) ([]byte, bool) {
+	if f.Count == 1 {
+		return f.Payload, true
+	}
+
+	key := messageKey{from, f.Seq}
+
+	p, ok := r.pending[key]
+	if !ok {
+		r.expire()
+
+		p = &partial{Parts: make([][]byte, f.Count), Started: time.Now()}
+		r.pending[key] = p
+	}
+
+	if int(f.Count) != len(p.Parts) || p.Parts[f.Index] != nil {
+		return nil, false
+	}
+
+	p.Parts[f.Index] = f.Payload
+	p.Received += 1
+
+	if p.Received < len(p.Parts) {
+		return nil, false
+	}
+
+	delete(r.pending, key)
+
+	var msg []byte
+	for _, part := range p.Parts {
+		msg = append(msg, part...)
+	}
+
+	return msg, true
+}
+
+// Drops the messages that waited too long, and the oldest ones
+// when there are too many pending.
+func (r *reassembler) expire() {
+	for len(r.pending) >= r.Limit {
+		var oldest messageKey
+		var started time.Time
+
+		for k, p := range r.pending {
+			if started.IsZero() || p.Started.Before(started) {
+				oldest, started = k, p.Started
+			}
+		}
+
+		delete(r.pending, oldest)
+		r.dropped()
+	}
+
+	for k, p := range r.pending {
+		if time.Since(p.Started) > r.Timeout {
+			delete(r.pending, k)
+			r.dropped()
+		}
+	}
+}
+
+// Reports a dropped message to the drop func.
+func (r *reassembler) dropped() {
+	if r.drop != nil {
+		r.drop()
+	}
+}
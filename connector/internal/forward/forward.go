@@ -0,0 +1,111 @@
+/*
+	Forward holds the load handlers of the load and typed 
+	packages written once over the type of the values, the 
+	load package instantiates them with interface{} and the 
+	typed package with the type of its connectors.
+*/
+package forward
+
+import (
+	"context"
+	"reflect"
+)
+
+// Builds the select cases to receive from every input, 
+// followed by a last case for the context being done.
+func receiveCases[T any](ctx context.Context, inputs []chan T) []reflect.SelectCase {
+	cases := make([]reflect.SelectCase, len(inputs)+1)
+
+	for i := range inputs {
+		cases[i].Dir = reflect.SelectRecv
+		cases[i].Chan = reflect.ValueOf(inputs[i])
+	}
+
+	cases[len(inputs)].Dir = reflect.SelectRecv
+	cases[len(inputs)].Chan = reflect.ValueOf(ctx.Done())
+
+	return cases
+}
+
+// Unwraps a received value, this also works when T is an 
+// interface and the value is nil.
+func value[T any](recv reflect.Value) T {
+	var v T
+	reflect.ValueOf(&v).Elem().Set(recv)
+	return v
+}
+
+// Sends the value to the output unless the context is done 
+// first, in which case false is returned.
+func send[T any](ctx context.Context, output chan T, v T) bool {
+	select {
+	case output <- v:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Receives from the inputs until they are all closed or the 
+// context is done, handing each value to f.  Returns as soon 
+// as f returns false.
+func receive[T any](ctx context.Context, inputs []chan T, f func(v T) bool) {
+	inputCount := len(inputs)
+
+	iCases := receiveCases(ctx, inputs)
+
+	for inputCount > 0 {
+		chosen, recv, recvOK := reflect.Select(iCases)
+		if chosen == len(inputs) {
+			return
+		}
+
+		if recvOK {
+			if !f(value[T](recv)) {
+				return
+			}
+		} else {
+			iCases[chosen].Chan = reflect.ValueOf(nil)
+			inputCount -= 1
+		}
+	}
+}
+
+// Disperses the values of the inputs between the outputs.
+func RoundRobin[T any](ctx context.Context, outputs []chan T, inputs []chan T) {
+	currentOutput := 0
+
+	receive(ctx, inputs, func(v T) bool {
+		if currentOutput > len(outputs) - 1 { currentOutput = 0 }
+
+		if !send(ctx, outputs[currentOutput], v) {
+			return false
+		}
+		currentOutput += 1
+		return true
+	})
+}
+
+// Copies the values of the inputs to every output.
+func Copy[T any](ctx context.Context, outputs []chan T, inputs []chan T) {
+	receive(ctx, inputs, func(v T) bool {
+		for i := range outputs {
+			if !send(ctx, outputs[i], v) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// Returns a handler sending every value of the inputs with the 
+// same key, as given by keyFn, to the same output.
+func HashPartition[T any](keyFn func(T) string) func(ctx context.Context, outputs []chan T, inputs []chan T) {
+	return func(ctx context.Context, outputs []chan T, inputs []chan T) {
+		ring := NewRing(len(outputs))
+
+		receive(ctx, inputs, func(v T) bool {
+			return send(ctx, outputs[ring.Pick(keyFn(v))], v)
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package forward
+
+import (
+	"github.com/go-emd/emd/log"
+	"context"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// Sends each value of the inputs to the buffered output with 
+// the most room left, or when they are all full to whichever 
+// output is ready first.  A timeout of zero waits for an 
+// output for as long as it takes.
+//
+// Otherwise an output that takes no value for the timeout is 
+// stalled and the values are only offered to the other outputs 
+// until it takes a value again.  Once every output is stalled 
+// the value is offered to all of them, no value is dropped.  
+// An output is logged when it stalls and when it recovers.
+func LeastLoaded[T any](ctx context.Context, outputs []chan T, inputs []chan T, timeout time.Duration) {
+	outputCount := len(outputs)
+	stalled := make([]bool, outputCount)
+
+	// Sends to every output, followed by the context being 
+	// done and the timeout.
+	oCases := make([]reflect.SelectCase, outputCount+2)
+
+	for i := range outputs {
+		oCases[i].Dir = reflect.SelectSend
+	}
+
+	oCases[outputCount].Dir = reflect.SelectRecv
+	oCases[outputCount].Chan = reflect.ValueOf(ctx.Done())
+	oCases[outputCount+1].Dir = reflect.SelectRecv
+
+	// Records that the output took a value.
+	took := func(i int) bool {
+		if stalled[i] {
+			stalled[i] = false
+			log.INFO.Println("LeastLoaded: output " + strconv.Itoa(i) + " recovered.")
+		}
+		return true
+	}
+
+	receive(ctx, inputs, func(v T) bool {
+		if i := leastLoadedOutput(outputs); i >= 0 {
+			select {
+			case outputs[i] <- v:
+				return took(i)
+			default:
+			}
+		}
+
+		send := reflect.ValueOf(&v).Elem()
+
+		for {
+			// Only the outputs that are not stalled are offered 
+			// the value, unless they all are.
+			all := true
+			for i := range outputs {
+				if timeout > 0 && !stalled[i] {
+					all = false
+				}
+			}
+
+			for i := range outputs {
+				oCases[i].Chan = reflect.ValueOf(nil)
+				if all || !stalled[i] {
+					oCases[i].Chan = reflect.ValueOf(outputs[i])
+					oCases[i].Send = send
+				}
+			}
+
+			var timer *time.Timer
+			oCases[outputCount+1].Chan = reflect.ValueOf(nil)
+			if !all {
+				timer = time.NewTimer(timeout)
+				oCases[outputCount+1].Chan = reflect.ValueOf(timer.C)
+			}
+
+			chosen, _, _ := reflect.Select(oCases)
+
+			if timer != nil {
+				timer.Stop()
+			}
+
+			switch chosen {
+			case outputCount:
+				return false
+			case outputCount + 1:
+				for i := range outputs {
+					if !stalled[i] {
+						stalled[i] = true
+						log.WARNING.Println("LeastLoaded: output " + strconv.Itoa(i) + " took no value for " + timeout.String() + ", it is stalled.")
+					}
+				}
+			default:
+				return took(chosen)
+			}
+		}
+	})
+}
+
+// Returns the buffered output with the lowest len/cap that 
+// still has room, or -1 when there is none.
+func leastLoadedOutput[T any](outputs []chan T) int {
+	best, bestLoad := -1, 1.0
+
+	for i, o := range outputs {
+		if cap(o) == 0 {
+			continue
+		}
+
+		if l := float64(len(o)) / float64(cap(o)); l < bestLoad {
+			best, bestLoad = i, l
+		}
+	}
+
+	return best
+}
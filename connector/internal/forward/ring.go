@@ -0,0 +1,62 @@
+package forward
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+)
+
+// The number of points each output gets on a Ring.  More points
+// spread the keys more evenly between the outputs.
+const ringReplicas = 128
+
+// A consistent hash ring mapping keys onto a number of outputs.
+// When the number of outputs changes only the keys of the added
+// or removed outputs move, the rest stay where they were.
+type Ring struct {
+	points  []uint64
+	outputs map[uint64]int
+}
+
+// Creates a ring over n outputs.
+func NewRing(n int) *Ring {
+	r := &Ring{
+		points:  make([]uint64, 0, n*ringReplicas),
+		outputs: make(map[uint64]int, n*ringReplicas),
+	}
+
+	for i := 0; i < n; i++ {
+		for j := 0; j < ringReplicas; j++ {
+			p := hash(strconv.Itoa(i) + "-" + strconv.Itoa(j))
+			if _, ok := r.outputs[p]; ok {
+				continue
+			}
+
+			r.outputs[p] = i
+			r.points = append(r.points, p)
+		}
+	}
+
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i] < r.points[j] })
+	return r
+}
+
+// Returns the output the key belongs to, the same key always
+// gets the same output.
+func (r *Ring) Pick(key string) int {
+	h := hash(key)
+
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+
+	return r.outputs[r.points[i]]
+}
+
+// Hashes a key with 64 bit FNV-1a.
+func hash(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return h.Sum64()
+}
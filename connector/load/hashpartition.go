@@ -0,0 +1,23 @@
+package load
+
+import (
+	"github.com/go-emd/emd/connector/internal/forward"
+)
+
+// A consistent hash ring mapping keys onto a number of outputs.
+// When the number of outputs changes only the keys of the added
+// or removed outputs move, the rest stay where they were.
+type Ring = forward.Ring
+
+// Creates a ring over n outputs.
+func NewRing(n int) *Ring {
+	return forward.NewRing(n)
+}
+
+// HashPartition is used when all the ingress traffic with the
+// same key must go to the same egress channel, for example when
+// the workers downstream keep state per key.  The keyFn extracts
+// the key from each piece of data.
+func HashPartition(keyFn func(interface{}) string) Kind {
+	return forward.HashPartition(keyFn)
+}
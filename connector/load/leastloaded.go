@@ -0,0 +1,27 @@
+package load
+
+import (
+	"github.com/go-emd/emd/connector/internal/forward"
+	"context"
+	"time"
+)
+
+// LeastLoaded is used when the egress channels drain at 
+// different rates.  Each piece of data goes to the buffered 
+// output with the most room left, or when they are all full 
+// to whichever output is ready first, so one slow worker 
+// does not stall the others.
+func LeastLoaded(ctx context.Context, outputs []chan interface{}, inputs []chan interface{}) {
+	forward.LeastLoaded(ctx, outputs, inputs, 0)
+}
+
+// LeastLoadedTimeout is LeastLoaded passing over the outputs 
+// that are stuck.  An output that takes no data for the timeout 
+// is logged as stalled and the data is only offered to the other 
+// outputs until it takes data again, or to all of them when 
+// they are all stalled.  No data is ever dropped.
+func LeastLoadedTimeout(timeout time.Duration) Kind {
+	return func(ctx context.Context, outputs []chan interface{}, inputs []chan interface{}) {
+		forward.LeastLoaded(ctx, outputs, inputs, timeout)
+	}
+}
@@ -11,25 +11,73 @@
 package load
 
 import (
-	"github.com/go-emd/emd/log"
-	"os"
+	"context"
+	"errors"
 )
 
+// Returned by NtoN when it is not given at least one input 
+// and one output.
+var ErrEndpoints = errors.New("load: NtoN requires at least one input and one output")
+
 // Function type that must be passed into the NtoN function call.  
-// This can either be the RoundRobin function, Copy function or a 
-// custom function in which the leader.template file will need 
-// to be edited within the emd distribution.
-type Kind func(outputs []chan interface{}, inputs []chan interface{})
+// This can either be the RoundRobin function, Copy function, 
+// LeastLoaded function, a HashPartition or a custom function in 
+// which the leader.template file will need to be edited within 
+// the emd distribution.
+//
+// The handler must return once every input is closed or the 
+// context is done, whichever happens first.
+type Kind func(ctx context.Context, outputs []chan interface{}, inputs []chan interface{})
+
+// Returned by NtoN to stop the forwarding and wait for it 
+// to finish.
+type Handle struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Runs f in its own go routine and returns the Handle 
+// controlling it.  The context given to f is done once the 
+// parent is done or the Handle is stopped.
+func Start(parent context.Context, f func(context.Context)) *Handle {
+	ctx, cancel := context.WithCancel(parent)
+	h := &Handle{cancel, make(chan struct{})}
+
+	go func() {
+		defer close(h.done)
+		defer cancel()
+		f(ctx)
+	}()
+
+	return h
+}
+
+// Tells the forwarding to stop, use Wait to know when it has.
+func (h *Handle) Stop() {
+	h.cancel()
+}
+
+// Closed once the forwarding has stopped.
+func (h *Handle) Done() <-chan struct{} {
+	return h.done
+}
+
+// Blocks until the forwarding has stopped.
+func (h *Handle) Wait() {
+	<-h.done
+}
 
 // Allows N connections' channels to have ingress traffic and will 
 // forward that traffic to the egress array of N connectors' channels.  
 // There are multiple types of forwarding that can be used such as 
-// round robin, and copy.
-func NtoN(handler Kind, outputs []chan interface{}, inputs []chan interface{}) {
+// round robin, and copy.  The forwarding runs until every input 
+// is closed, the context is done or the returned Handle is stopped.
+func NtoN(ctx context.Context, handler Kind, outputs []chan interface{}, inputs []chan interface{}) (*Handle, error) {
 	if len(inputs) == 0 || len(outputs) == 0 {
-		log.ERROR.Println("NtoN requires at least one input and one output")
-		os.Exit(1)
+		return nil, ErrEndpoints
 	}
 
-	go handler(outputs, inputs)
+	return Start(ctx, func(ctx context.Context) {
+		handler(ctx, outputs, inputs)
+	}), nil
 }
@@ -1,7 +1,11 @@
 package load
 
 import (
+	"context"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 	"github.com/go-emd/emd/log"
 	"io/ioutil"
 )
@@ -16,7 +20,7 @@ func TestCopy(t *testing.T) {
 	out[0] = make(chan interface{}, 0)
 	out[1] = make(chan interface{}, 0)
 
-	NtoN(Copy, out, in)
+	NtoN(context.Background(), Copy, out, in)
 
 	in[0] <- "TEST"
 	out1 := <- out[0]
@@ -39,7 +43,7 @@ func TestRoundRobin(t *testing.T) {
 	out[0] = make(chan interface{}, 0)
 	out[1] = make(chan interface{}, 0)
 
-	NtoN(RoundRobin, out, in)
+	NtoN(context.Background(), RoundRobin, out, in)
 
 	in[0] <- "TEST1"
 	out1 := <- out[0]
@@ -53,3 +57,176 @@ func TestRoundRobin(t *testing.T) {
 
 	in[0] <- nil
 }
+
+func TestHashPartition(t *testing.T) {
+	log.Init(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
+
+	in := make([]chan interface{}, 1)
+	in[0] = make(chan interface{}, 0)
+
+	out := make([]chan interface{}, 3)
+	for i := range out {
+		out[i] = make(chan interface{}, 10)
+	}
+
+	key := func(data interface{}) string {
+		return strings.SplitN(data.(string), ":", 2)[0]
+	}
+
+	NtoN(context.Background(), HashPartition(key), out, in)
+
+	for _, data := range []string{"a:1", "b:1", "c:1", "a:2", "b:2", "c:2"} {
+		in[0] <- data
+	}
+	close(in[0])
+
+	// Every key must land on a single output.
+	outputOf := make(map[string]int)
+	for i := range out {
+		for len(out[i]) > 0 {
+			k := key(<-out[i])
+			if o, ok := outputOf[k]; ok && o != i {
+				t.Error("key", k, "went to outputs", o, "and", i)
+			}
+			outputOf[k] = i
+		}
+	}
+
+	if len(outputOf) != 3 {
+		t.Error("missing keys", outputOf)
+	}
+}
+
+func TestRing(t *testing.T) {
+	before := NewRing(10)
+	after := NewRing(11)
+
+	moved := 0
+	for i := 0; i < 1000; i++ {
+		k := strconv.Itoa(i)
+		if before.Pick(k) != after.Pick(k) {
+			moved += 1
+		}
+	}
+
+	// Adding one output should move roughly a tenth of 
+	// the keys, not most of them.
+	if moved > 200 {
+		t.Error("too many keys moved", moved)
+	}
+}
+
+func TestNtoNStop(t *testing.T) {
+	log.Init(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
+
+	if _, err := NtoN(context.Background(), Copy, nil, nil); err != ErrEndpoints {
+		t.Error("expected ErrEndpoints got", err)
+	}
+
+	in := make([]chan interface{}, 1)
+	in[0] = make(chan interface{}, 0)
+
+	out := make([]chan interface{}, 1)
+	out[0] = make(chan interface{}, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	h, err := NtoN(ctx, RoundRobin, out, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Cancelling the context stops the handler while it waits 
+	// on its inputs.
+	cancel()
+
+	select {
+	case <-h.Done():
+	case <-time.After(time.Second):
+		t.Error("NtoN did not stop")
+	}
+
+	h, err = NtoN(context.Background(), Copy, out, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Stopping the handle stops the handler while it waits on 
+	// its outputs.
+	in[0] <- "TEST"
+	h.Stop()
+	h.Wait()
+}
+
+func TestLeastLoaded(t *testing.T) {
+	log.Init(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
+
+	in := make([]chan interface{}, 1)
+	in[0] = make(chan interface{}, 0)
+
+	// The first output is never read, it must not stall 
+	// the second one.
+	out := make([]chan interface{}, 3)
+	out[0] = make(chan interface{}, 0)
+	out[1] = make(chan interface{}, 4)
+	out[2] = make(chan interface{}, 4)
+
+	out[1] <- "FULL"
+	out[1] <- "FULL"
+
+	h, err := NtoN(context.Background(), LeastLoaded, out, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The emptier buffered output is picked first.
+	in[0] <- "TEST1"
+	in[0] <- "TEST2"
+	in[0] <- "TEST3"
+	close(in[0])
+	h.Wait()
+
+	if len(out[1]) != 3 || len(out[2]) != 2 {
+		t.Error("unexpected loads", len(out[1]), len(out[2]))
+	}
+
+	if <-out[2] != "TEST1" {
+		t.Error("least loaded output was not used first")
+	}
+}
+
+func TestLeastLoadedTimeout(t *testing.T) {
+	log.Init(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
+
+	in := make([]chan interface{}, 1)
+	in[0] = make(chan interface{}, 0)
+
+	out := make([]chan interface{}, 2)
+	out[0] = make(chan interface{}, 0)
+	out[1] = make(chan interface{}, 0)
+
+	h, err := NtoN(context.Background(), LeastLoadedTimeout(time.Millisecond*10), out, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Nobody reads the outputs past the timeout, so both 
+	// stall but TEST1 is still offered to them.
+	in[0] <- "TEST1"
+	time.Sleep(time.Millisecond * 30)
+
+	if data := <-out[1]; data != "TEST1" {
+		t.Error("expected TEST1 got", data)
+	}
+
+	// The second output took data so it recovered, while 
+	// the first one is still passed over.
+	in[0] <- "TEST2"
+
+	if data := <-out[1]; data != "TEST2" {
+		t.Error("expected TEST2 got", data)
+	}
+
+	h.Stop()
+	h.Wait()
+}
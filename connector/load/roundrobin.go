@@ -1,33 +1,12 @@
 package load
 
 import (
-	"reflect"
+	"github.com/go-emd/emd/connector/internal/forward"
+	"context"
 )
 
 // RoundRobin is used when the ingress traffic should be 
 // dispersed between the egress channels.
-func RoundRobin(outputs []chan interface{}, inputs []chan interface{}) {
-	inputCount := len(inputs)
-	outputCount := len(outputs)
-	currentOutput := 0
-
-	iCases := make([]reflect.SelectCase, inputCount)
-
-	for i := range iCases {
-		iCases[i].Dir = reflect.SelectRecv
-		iCases[i].Chan = reflect.ValueOf(inputs[i])
-	}
-
-	for inputCount > 0 {
-		chosen, recv, recvOK := reflect.Select(iCases)
-		if recvOK {
-			if currentOutput > outputCount - 1 { currentOutput = 0 }
-
-			outputs[currentOutput] <- recv.Interface()
-			currentOutput += 1
-		} else {
-			iCases[chosen].Chan = reflect.ValueOf(nil)
-			inputCount -= 1
-		}
-	}
+func RoundRobin(ctx context.Context, outputs []chan interface{}, inputs []chan interface{}) {
+	forward.RoundRobin(ctx, outputs, inputs)
 }
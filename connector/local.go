@@ -1,33 +1,130 @@
 package connector
 
 import (
+	"github.com/go-emd/emd/core"
 	"github.com/go-emd/emd/log"
+	"context"
 )
 
-// The most basic implementation of a connector, 
-// this turns into just a go chan of type 
-// interface{}.  It allows only one way communication 
+// The most basic implementation of a connector,
+// this turns into just a go chan of type
+// interface{}.  It allows only one way communication
 // in order to keep all connectors in sync.
+//
+// The two ends made by NewLocal each have their own chan, 
+// the ingress end moves the values across while it is open 
+// and counts them just like the External connectors do.  A 
+// Local built around a single chan both workers use works 
+// as well but the values never pass through it, unless the 
+// receiving worker is given its Ingress.
 type Local struct {
 	Base
+
+	from     *Local
+	counters counters
+	life     lifecycle
+
+	// The value the ingress took from the egress but had not 
+	// handed over when it was closed, kept for the next Open.
+	pending    interface{}
+	hasPending bool
+}
+
+// Creates the two ends of a Local connection.  The sending 
+// worker writes to the Channel of the egress, which buffers 
+// the given number of values, and the receiving worker reads 
+// the Channel of the ingress.
+func NewLocal(egress, ingress string, buffer int) (*Local, *Local) {
+	e := &Local{Base: Base{Core: core.Core{Name_: egress}, Channel_: make(chan interface{}, buffer)}}
+	return e, e.Ingress(ingress)
 }
 
-// For a chan the Open method is useless since the 
-// chan is already ready to go.  But this is nice 
-// for logging the sequential life of the connector.
-func (l *Local) Open() {
+// Returns a new ingress end moving the values written to the 
+// chan of the Local across, the Local becomes the egress end.  
+// The receiving worker of a Local both workers share is given 
+// the ingress so the values going across are counted.
+func (l *Local) Ingress(name string) *Local {
+	return &Local{Base: Base{Core: core.Core{Name_: name}, Channel_: make(chan interface{})}, from: l}
+}
+
+// For a chan the Open method is useless since the
+// chan is already ready to go.  But this is nice
+// for logging the sequential life of the connector.  
+// The ingress end of a NewLocal connection starts moving 
+// the values across.
+func (l *Local) Open(ctx context.Context) error {
+	if l.from == nil {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		log.INFO.Println("Local: " + l.Name_ + " is opened.")
+		return nil
+	}
+
+	ctx, err := l.life.begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	l.life.spawn(func() { l.relay(ctx) })
+
 	log.INFO.Println("Local: " + l.Name_ + " is opened.")
+	return nil
 }
 
-// For a chan the close method is useful but problem is 
-// which side of the communication should close the chan.  
-// Therefore we rely on garbage collection to perform 
-// these necessary actions.
-func (l *Local) Close() {
+// For a chan the close method is useful but problem is
+// which side of the communication should close the chan.
+// Therefore we rely on garbage collection to perform
+// these necessary actions.  The ingress end of a NewLocal 
+// connection stops moving the values across.
+func (l *Local) Close() error {
+	if l.from != nil {
+		if err := l.life.end(); err != nil {
+			return err
+		}
+	}
+
 	log.INFO.Println("Local: " + l.Name_ + " is closed.")
+	return nil
+}
+
+// Moves the values written to the egress end to the chan of 
+// the ingress until the context is done, a value the 
+// receiving worker did not take by then is handed over first 
+// once the ingress is opened again.
+func (l *Local) relay(ctx context.Context) {
+	for {
+		if !l.hasPending {
+			select {
+			case l.pending = <-l.from.Channel_:
+				l.hasPending = true
+				l.from.counters.send(0)
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		select {
+		case l.Channel_ <- l.pending:
+			l.pending, l.hasPending = nil, false
+			l.counters.receive()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Returns the values sent by the egress end or received by 
+// the ingress end of a NewLocal connection along with the 
+// length and capacity of the chan.  A Local both workers 
+// use only has the length and capacity, its counters are 
+// always zero.
+func (l *Local) Stats() Stats {
+	return l.counters.stats(l.Channel_)
 }
 
-// Returns the chan interface{} that is in the underlying 
+// Returns the chan interface{} that is in the underlying
 // inherited connector.Base class.
 func (l *Local) Channel() chan interface{} {
 	return l.Channel_
@@ -0,0 +1,108 @@
+package connector
+
+import (
+	"sync/atomic"
+)
+
+// The traffic a connector has seen along with the current length
+// and capacity of its channel.  The counters start when the
+// connector is created and keep counting across every Open and
+// Close.
+//
+// Sent and Received count the values an egress wrote and an
+// ingress handed to its channel, the bytes are those on the wire
+// including framing and values sent again.  Dropped counts the
+// values thrown away for any reason other than the codec failing,
+// such as duplicates, malformed or incomplete datagrams and UDP
+// writes that failed.
+type Stats struct {
+	Sent          uint64
+	Received      uint64
+	BytesSent     uint64
+	BytesReceived uint64
+	EncodeErrors  uint64
+	DecodeErrors  uint64
+	Dropped       uint64
+	Length        int
+	Capacity      int
+}
+
+// Implemented by the connectors that keep Stats, every connector
+// in this package does.
+type Instrumented interface {
+	Stats() Stats
+}
+
+// Returns the Stats of any connector, only the length and capacity
+// of the channel when the connector is not Instrumented.
+func StatsOf(c Connector) Stats {
+	if i, ok := c.(Instrumented); ok {
+		return i.Stats()
+	}
+
+	ch := c.Channel()
+	return Stats{Length: len(ch), Capacity: cap(ch)}
+}
+
+// The counters behind Stats, safe to update from the go routines
+// of a connector while they are read.
+type counters struct {
+	sent          uint64
+	received      uint64
+	bytesSent     uint64
+	bytesReceived uint64
+	encodeErrors  uint64
+	decodeErrors  uint64
+	dropped       uint64
+}
+
+// Records a value written with the bytes it took.
+func (c *counters) send(bytes int) {
+	atomic.AddUint64(&c.sent, 1)
+	atomic.AddUint64(&c.bytesSent, uint64(bytes))
+}
+
+// Records bytes written again for values already counted.
+func (c *counters) resend(bytes int) {
+	atomic.AddUint64(&c.bytesSent, uint64(bytes))
+}
+
+// Records a value handed to the channel.
+func (c *counters) receive() {
+	atomic.AddUint64(&c.received, 1)
+}
+
+// Records bytes read off the wire.
+func (c *counters) read(bytes int) {
+	atomic.AddUint64(&c.bytesReceived, uint64(bytes))
+}
+
+// Records a value that could not be encoded.
+func (c *counters) encodeError() {
+	atomic.AddUint64(&c.encodeErrors, 1)
+}
+
+// Records a value that could not be decoded.
+func (c *counters) decodeError() {
+	atomic.AddUint64(&c.decodeErrors, 1)
+}
+
+// Records a value that was thrown away.
+func (c *counters) drop() {
+	atomic.AddUint64(&c.dropped, 1)
+}
+
+// Returns the counters along with the state of the channel.
+func (c *counters) stats(ch chan interface{}) Stats {
+	return Stats{
+		Sent:          atomic.LoadUint64(&c.sent),
+		Received:      atomic.LoadUint64(&c.received),
+		BytesSent:     atomic.LoadUint64(&c.bytesSent),
+		BytesReceived: atomic.LoadUint64(&c.bytesReceived),
+		EncodeErrors:  atomic.LoadUint64(&c.encodeErrors),
+		DecodeErrors:  atomic.LoadUint64(&c.decodeErrors),
+		Dropped:       atomic.LoadUint64(&c.dropped),
+		Length:        len(ch),
+		Capacity:      cap(ch),
+	}
+}
@@ -0,0 +1,431 @@
+package connector
+
+import (
+	"github.com/go-emd/emd/log"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// The bounds of the exponential backoff used by the stream
+// egress connectors while they wait for the leader on the
+// other end to come back up.
+var (
+	streamMinBackoff = time.Millisecond * 100
+	streamMaxBackoff = time.Second * 5
+)
+
+// The largest encoded value a stream ingress will accept.
+const streamMaxPayload = 1 << 26
+
+// Returned when an envelope claims a payload over streamMaxPayload.
+var ErrEnvelopeSize = errors.New("envelope: payload too large")
+
+// Simply hold TCP specific information in order
+// to maintain a persistent TCP connection.  It is
+// used by every connector built on a stream socket.
+type Tcp struct {
+	Conn net.Conn
+	mu   sync.Mutex
+	life lifecycle
+}
+
+// Every value sent over a stream is wrapped in an envelope which
+// is written as this header followed by the encoded value:
+//
+//	session uint64  picked by the egress when it is opened
+//	seq     uint64  sequence number of the value
+//	ack     uint8   1 when the egress runs AtLeastOnce
+//	length  uint32  number of bytes in the encoded value
+//
+// When ack is set the ingress answers with the seq as a uint64
+// once the value is handed to its channel.  The session lets the
+// ingress drop duplicates even when they arrive over a new
+// connection.  All numbers are big endian.
+type envelope struct {
+	Session uint64
+	Seq     uint64
+	Ack     bool
+	Payload []byte
+}
+
+// The size of the header in front of every envelope.
+const envelopeHeaderSize = 21
+
+// Writes the envelope with a single call so it is never
+// interleaved with anything else.
+func (env envelope) writeTo(w io.Writer) error {
+	b := make([]byte, env.size())
+
+	binary.BigEndian.PutUint64(b[0:], env.Session)
+	binary.BigEndian.PutUint64(b[8:], env.Seq)
+	if env.Ack {
+		b[16] = 1
+	}
+	binary.BigEndian.PutUint32(b[17:], uint32(len(env.Payload)))
+	copy(b[envelopeHeaderSize:], env.Payload)
+
+	_, err := w.Write(b)
+	return err
+}
+
+// Returns the number of bytes the envelope takes on the wire.
+func (env envelope) size() int {
+	return envelopeHeaderSize + len(env.Payload)
+}
+
+// Reads the next envelope from the stream.
+func readEnvelope(r io.Reader) (envelope, error) {
+	var env envelope
+	var b [envelopeHeaderSize]byte
+
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return env, err
+	}
+
+	env.Session = binary.BigEndian.Uint64(b[0:])
+	env.Seq = binary.BigEndian.Uint64(b[8:])
+	env.Ack = b[16] == 1
+
+	length := binary.BigEndian.Uint32(b[17:])
+	if length > streamMaxPayload {
+		return env, ErrEnvelopeSize
+	}
+
+	env.Payload = make([]byte, length)
+	_, err := io.ReadFull(r, env.Payload)
+	return env, err
+}
+
+// The listening half shared by the ExternalTCPIngress and the
+// ExternalUnixIngress.  It accepts any number of connections
+// and forwards the values of each to the channel.
+type streamIngress struct {
+	Tcp
+	Listener net.Listener
+	conns    map[net.Conn]bool
+}
+
+// Starts a new life of the connector on the listener.
+func (s *streamIngress) open(ctx context.Context, e *External, listener net.Listener) error {
+	conns := make(map[net.Conn]bool)
+
+	ctx, err := s.life.begin(ctx, listener, closerFunc(func() error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		for conn := range conns {
+			conn.Close()
+		}
+		return nil
+	}))
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.Listener = listener
+	s.conns = conns
+	s.mu.Unlock()
+
+	s.life.spawn(func() { s.accept(ctx, e, listener, conns) })
+	return nil
+}
+
+// Accepts connections until the listener is closed, each
+// connection is read by its own go routine.
+func (s *streamIngress) accept(ctx context.Context, e *External, listener net.Listener, conns map[net.Conn]bool) {
+	received := newDedup()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			log.ERROR.Println(err)
+			time.Sleep(streamMinBackoff)
+			continue
+		}
+
+		s.mu.Lock()
+		if ctx.Err() != nil {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		conns[conn] = true
+		s.mu.Unlock()
+
+		s.life.spawn(func() { s.receive(ctx, e, conn, conns, received) })
+	}
+}
+
+// Decodes values from a single connection and forwards them
+// to the channel until the connection or connector is closed.
+// Values that ask for it are acknowledged on the same connection.
+func (s *streamIngress) receive(ctx context.Context, e *External, conn net.Conn, conns map[net.Conn]bool, received *dedup) {
+	defer func() {
+		s.mu.Lock()
+		delete(conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	reader := bufio.NewReader(conn)
+	codec := e.codec()
+
+	for {
+		env, err := readEnvelope(reader)
+		if err != nil {
+			if err != io.EOF && ctx.Err() == nil {
+				log.ERROR.Println(err)
+			}
+			return
+		}
+		e.counters.read(env.size())
+
+		if !env.Ack || !received.seen(sessionKey(env.Session), env.Seq) {
+			data, err := codec.Decode(bytes.NewReader(env.Payload))
+			if err != nil {
+				log.ERROR.Println(err)
+				e.counters.decodeError()
+				continue
+			}
+
+			select {
+			case e.Channel_ <- data:
+				e.counters.receive()
+			case <-ctx.Done():
+				return
+			}
+		} else {
+			e.counters.drop()
+		}
+
+		if env.Ack {
+			var ack [8]byte
+			binary.BigEndian.PutUint64(ack[:], env.Seq)
+
+			if _, err := conn.Write(ack[:]); err != nil {
+				log.WARNING.Println(err)
+				return
+			}
+		}
+	}
+}
+
+// The dialing half shared by the ExternalTCPEgress and the
+// ExternalUnixEgress.  It keeps a single connection open to
+// the ingress, reconnecting whenever it drops.
+type streamEgress struct {
+	Tcp
+}
+
+// Starts a new life of the connector sending to the address.
+// The connection itself is made in the background so the other
+// leader does not need to be up yet.
+func (s *streamEgress) open(ctx context.Context, e *External, network, address string) error {
+	ctx, err := s.life.begin(ctx, closerFunc(s.hangUp))
+	if err != nil {
+		return err
+	}
+
+	s.life.spawn(func() { s.send(ctx, e, network, address) })
+	return nil
+}
+
+// Encodes everything from the channel onto the connection.  When
+// running AtLeastOnce each value is kept until it is acknowledged,
+// values that were not acknowledged in time are sent again, and no
+// new values are taken while the window is full.
+func (s *streamEgress) send(ctx context.Context, e *External, network, address string) {
+	var conn net.Conn
+	var seq uint64
+	var inflight *window
+	var acks chan uint64
+	var retry <-chan time.Time
+
+	session := newSession()
+	codec := e.codec()
+
+	if e.reliable() {
+		inflight = newWindow()
+		acks = make(chan uint64)
+
+		ticker := time.NewTicker(deliveryTimeout / 2)
+		defer ticker.Stop()
+		retry = ticker.C
+	}
+
+	dial := func() net.Conn {
+		return s.dial(ctx, e, network, address, acks)
+	}
+
+	for {
+		input := e.Channel_
+		if inflight != nil && inflight.full() {
+			input = nil
+		}
+
+		select {
+		case data := <-input:
+			var payload bytes.Buffer
+
+			if err := codec.Encode(&payload, data); err != nil {
+				log.ERROR.Println(err)
+				e.counters.encodeError()
+				continue
+			}
+
+			env := envelope{session, seq, inflight != nil, payload.Bytes()}
+			seq += 1
+
+			if inflight != nil {
+				inflight.add(env.Seq, env)
+			}
+
+			if conn = s.transmit(ctx, conn, env, dial); conn == nil {
+				return
+			}
+			e.counters.send(env.size())
+		case ack := <-acks:
+			inflight.ack(ack)
+		case <-retry:
+			for _, v := range inflight.due(deliveryTimeout) {
+				env := v.(envelope)
+				if conn = s.transmit(ctx, conn, env, dial); conn == nil {
+					return
+				}
+				e.counters.resend(env.size())
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Writes a single envelope, connecting first when there is no
+// connection.  When the connection fails the envelope is kept and
+// sent again once a new connection is made.  Returns the connection
+// to use next time or nil when the connector was closed.
+func (s *streamEgress) transmit(ctx context.Context, conn net.Conn, env envelope, dial func() net.Conn) net.Conn {
+	for {
+		if conn == nil {
+			if conn = dial(); conn == nil {
+				return nil
+			}
+		}
+
+		err := env.writeTo(conn)
+		if err == nil {
+			return conn
+		}
+
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		log.WARNING.Println(err)
+		s.hangUp()
+		conn = nil
+	}
+}
+
+// Closes the current connection if there is one.
+func (s *streamEgress) hangUp() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Conn == nil {
+		return nil
+	}
+
+	err := s.Conn.Close()
+	s.Conn = nil
+	return err
+}
+
+// Connects to the address backing off exponentially between
+// attempts.  Acks are read from the new connection when the
+// connector runs AtLeastOnce.  Returns nil only when the connector
+// was closed.
+func (s *streamEgress) dial(ctx context.Context, e *External, network, address string, acks chan<- uint64) net.Conn {
+	var dialer net.Dialer
+	backoff := streamMinBackoff
+
+	for {
+		conn, err := dialer.DialContext(ctx, network, address)
+		if err == nil {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+
+			if ctx.Err() != nil {
+				conn.Close()
+				return nil
+			}
+
+			s.Conn = conn
+			if acks != nil {
+				s.life.spawn(func() { receiveAcks(ctx, conn, acks) })
+			}
+
+			log.INFO.Println("Connector " + e.Name_ + " is connected to " + address + ".")
+			return conn
+		}
+
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		log.WARNING.Println(err)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil
+		}
+
+		if backoff *= 2; backoff > streamMaxBackoff {
+			backoff = streamMaxBackoff
+		}
+	}
+}
+
+// Reads the acks sent back by the ingress over one connection
+// until it is closed.
+func receiveAcks(ctx context.Context, conn net.Conn, acks chan<- uint64) {
+	reader := bufio.NewReader(conn)
+
+	for {
+		var ack [8]byte
+		if _, err := io.ReadFull(reader, ack[:]); err != nil {
+			return
+		}
+
+		select {
+		case acks <- binary.BigEndian.Uint64(ack[:]):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Picks a random session for an egress, falling back on the
+// clock if there is no randomness available.
+func newSession() uint64 {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return uint64(time.Now().UnixNano())
+	}
+
+	return binary.BigEndian.Uint64(b[:])
+}
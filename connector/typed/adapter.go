@@ -0,0 +1,153 @@
+package typed
+
+import (
+	"github.com/go-emd/emd/connector"
+	"github.com/go-emd/emd/log"
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Runs the go routine that moves values between the typed
+// and untyped channels of an adapter.
+type pump struct {
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// Opens the untyped connector and starts f in a go routine
+// which must return once the context it is given is done.
+func (p *pump) start(ctx context.Context, c connector.Connector, f func(context.Context)) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.cancel != nil {
+		return connector.ErrAlreadyOpen
+	}
+
+	if err := c.Open(ctx); err != nil {
+		return err
+	}
+
+	ctx, p.cancel = context.WithCancel(ctx)
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		f(ctx)
+	}()
+
+	return nil
+}
+
+// Stops the go routine then closes the untyped connector.
+func (p *pump) stop(c connector.Connector) error {
+	p.mu.Lock()
+	cancel := p.cancel
+	p.cancel = nil
+	p.mu.Unlock()
+
+	if cancel == nil {
+		return connector.ErrNotOpen
+	}
+
+	cancel()
+	p.wg.Wait()
+
+	return c.Close()
+}
+
+// Reads the values of an untyped connector, such as an
+// ExternalUDPIngress, as values of type T.  Values of any
+// other type are logged and dropped.
+type Ingress[T any] struct {
+	Untyped  connector.Connector
+	Channel_ chan T
+	pump
+}
+
+// Opens the untyped connector and starts forwarding its values.
+func (i *Ingress[T]) Open(ctx context.Context) error {
+	return i.start(ctx, i.Untyped, func(ctx context.Context) {
+		for {
+			select {
+			case v := <-i.Untyped.Channel():
+				t, ok := v.(T)
+				if !ok {
+					log.WARNING.Println(fmt.Sprintf("Ingress: dropped a %T, expected a %T", v, t))
+					continue
+				}
+
+				select {
+				case i.Channel_ <- t:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	})
+}
+
+// Stops forwarding and closes the untyped connector.
+func (i *Ingress[T]) Close() error {
+	return i.stop(i.Untyped)
+}
+
+// Returns the chan T to read from.
+func (i *Ingress[T]) Channel() chan T {
+	return i.Channel_
+}
+
+// Writes values of type T to an untyped connector, such as
+// an ExternalUDPEgress.
+type Egress[T any] struct {
+	Untyped  connector.Connector
+	Channel_ chan T
+	pump
+}
+
+// Opens the untyped connector and starts forwarding to it.
+func (e *Egress[T]) Open(ctx context.Context) error {
+	return e.start(ctx, e.Untyped, func(ctx context.Context) {
+		for {
+			select {
+			case t := <-e.Channel_:
+				select {
+				case e.Untyped.Channel() <- t:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	})
+}
+
+// Stops forwarding and closes the untyped connector.
+func (e *Egress[T]) Close() error {
+	return e.stop(e.Untyped)
+}
+
+// Returns the chan T to write to.
+func (e *Egress[T]) Channel() chan T {
+	return e.Channel_
+}
+
+// Lets a typed connector sit in the worker.Work Ports_ map so
+// the leader can open and close it.  The worker uses the typed
+// connector itself, the untyped Channel of a port is nil.
+func Port[T any](c Connector[T]) connector.Connector {
+	return port[T]{c}
+}
+
+type port[T any] struct {
+	Connector[T]
+}
+
+func (p port[T]) Channel() chan interface{} {
+	return nil
+}
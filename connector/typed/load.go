@@ -0,0 +1,59 @@
+package typed
+
+import (
+	"github.com/go-emd/emd/connector/internal/forward"
+	"github.com/go-emd/emd/connector/load"
+	"context"
+	"time"
+)
+
+// The generic version of the load.Kind function type.
+type Kind[T any] func(ctx context.Context, outputs []chan T, inputs []chan T)
+
+// The generic version of load.NtoN, it forwards the ingress
+// traffic of N channels to the egress array of N channels
+// using the handler until the inputs are closed, the context
+// is done or the returned Handle is stopped.
+func NtoN[T any](ctx context.Context, handler Kind[T], outputs []chan T, inputs []chan T) (*load.Handle, error) {
+	if len(inputs) == 0 || len(outputs) == 0 {
+		return nil, load.ErrEndpoints
+	}
+
+	return load.Start(ctx, func(ctx context.Context) {
+		handler(ctx, outputs, inputs)
+	}), nil
+}
+
+// The generic version of load.RoundRobin, the ingress traffic
+// is dispersed between the egress channels.
+func RoundRobin[T any](ctx context.Context, outputs []chan T, inputs []chan T) {
+	forward.RoundRobin(ctx, outputs, inputs)
+}
+
+// The generic version of load.Copy, the ingress traffic is
+// copied to all the egress channels.
+func Copy[T any](ctx context.Context, outputs []chan T, inputs []chan T) {
+	forward.Copy(ctx, outputs, inputs)
+}
+
+// The generic version of load.HashPartition, all the ingress
+// traffic with the same key goes to the same egress channel.
+func HashPartition[T any](keyFn func(T) string) Kind[T] {
+	return forward.HashPartition(keyFn)
+}
+
+// The generic version of load.LeastLoaded, each value goes to
+// the buffered output with the most room left, or when they are
+// all full to whichever output is ready first.
+func LeastLoaded[T any](ctx context.Context, outputs []chan T, inputs []chan T) {
+	forward.LeastLoaded(ctx, outputs, inputs, 0)
+}
+
+// The generic version of load.LeastLoadedTimeout, the outputs
+// that take no value for the timeout are passed over until
+// they take one again.
+func LeastLoadedTimeout[T any](timeout time.Duration) Kind[T] {
+	return func(ctx context.Context, outputs []chan T, inputs []chan T) {
+		forward.LeastLoaded(ctx, outputs, inputs, timeout)
+	}
+}
@@ -0,0 +1,65 @@
+/*
+	The typed package holds the generic versions of the
+	connectors and load handlers.  A typed.Connector[T]
+	carries values of type T instead of interface{} so a
+	worker sending the wrong type fails to compile rather
+	than panicking on a type assertion at runtime.
+
+	The untyped connectors, such as the External ones which
+	only ever see interface{} values on the wire, are used
+	through the Ingress and Egress adapters.  A typed connector
+	is handed to the leader, which only knows about the
+	connector.Connector interface, by wrapping it with Port.
+*/
+package typed
+
+import (
+	"github.com/go-emd/emd/core"
+	"github.com/go-emd/emd/log"
+	"context"
+)
+
+// The generic version of the connector.Connector interface.
+type Connector[T any] interface {
+	Open(ctx context.Context) error
+	Close() error
+	Channel() chan T
+}
+
+// The generic version of the connector.Base struct which
+// every typed connector implementation inherits.
+type Base[T any] struct {
+	core.Core
+	Channel_ chan T
+}
+
+// The generic version of the connector.Local connector,
+// simply a go chan of type T.
+type Local[T any] struct {
+	Base[T]
+}
+
+// For a chan the Open method is useless since the
+// chan is already ready to go.  But this is nice
+// for logging the sequential life of the connector.
+func (l *Local[T]) Open(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	log.INFO.Println("Local: " + l.Name_ + " is opened.")
+	return nil
+}
+
+// Like the connector.Local the chan is left for garbage
+// collection.
+func (l *Local[T]) Close() error {
+	log.INFO.Println("Local: " + l.Name_ + " is closed.")
+	return nil
+}
+
+// Returns the chan T that is in the underlying inherited
+// typed.Base class.
+func (l *Local[T]) Channel() chan T {
+	return l.Channel_
+}
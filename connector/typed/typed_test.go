@@ -0,0 +1,221 @@
+package typed
+
+import (
+	"github.com/go-emd/emd/connector"
+	"github.com/go-emd/emd/connector/load"
+	"github.com/go-emd/emd/core"
+	"github.com/go-emd/emd/log"
+	"context"
+	"io/ioutil"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestLocal(t *testing.T) {
+	log.Init(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
+
+	mylocal := &Local[string]{Base[string]{core.Core{Name_: "Test"}, make(chan string, 1)}}
+
+	var c Connector[string] = mylocal
+	if err := c.Open(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	c.Channel() <- "HEY"
+	if data := <-c.Channel(); data != "HEY" {
+		t.Fail()
+	}
+
+	if err := Port[string](c).Close(); err != nil {
+		t.Fail()
+	}
+}
+
+func TestAdapters(t *testing.T) {
+	log.Init(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
+
+	untyped := make(chan interface{})
+
+	egress := &Egress[int]{
+		Untyped:  &connector.Local{Base: connector.Base{Core: core.Core{Name_: "Out"}, Channel_: untyped}},
+		Channel_: make(chan int),
+	}
+
+	ingress := &Ingress[int]{
+		Untyped:  &connector.Local{Base: connector.Base{Core: core.Core{Name_: "In"}, Channel_: untyped}},
+		Channel_: make(chan int),
+	}
+
+	if err := egress.Open(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ingress.Open(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ingress.Open(context.Background()); err != connector.ErrAlreadyOpen {
+		t.Error("expected ErrAlreadyOpen got", err)
+	}
+
+	egress.Channel() <- 42
+
+	select {
+	case <-time.After(time.Second * 2):
+		t.Fatal("timed out waiting for data")
+	case data := <-ingress.Channel():
+		if data != 42 {
+			t.Fail()
+		}
+	}
+
+	// The wrong type is dropped rather than delivered.
+	untyped <- "not an int"
+	egress.Channel() <- 7
+
+	if data := <-ingress.Channel(); data != 7 {
+		t.Fail()
+	}
+
+	if err := egress.Close(); err != nil {
+		t.Error(err)
+	}
+
+	if err := ingress.Close(); err != nil {
+		t.Error(err)
+	}
+
+	if err := ingress.Close(); err != connector.ErrNotOpen {
+		t.Error("expected ErrNotOpen got", err)
+	}
+}
+
+func TestCopy(t *testing.T) {
+	log.Init(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
+
+	in := []chan string{make(chan string)}
+	out := []chan string{make(chan string), make(chan string)}
+
+	NtoN(context.Background(), Copy[string], out, in)
+
+	in[0] <- "TEST"
+	if <-out[0] != "TEST" || <-out[1] != "TEST" {
+		t.Fail()
+	}
+
+	close(in[0])
+}
+
+func TestRoundRobin(t *testing.T) {
+	log.Init(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
+
+	in := []chan error{make(chan error)}
+	out := []chan error{make(chan error), make(chan error)}
+
+	NtoN(context.Background(), RoundRobin[error], out, in)
+
+	// A nil interface value must make it through as well.
+	in[0] <- nil
+	if <-out[0] != nil {
+		t.Fail()
+	}
+
+	in[0] <- context.Canceled
+	if <-out[1] != context.Canceled {
+		t.Fail()
+	}
+
+	close(in[0])
+}
+
+func TestHashPartition(t *testing.T) {
+	log.Init(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
+
+	in := []chan int{make(chan int)}
+	out := []chan int{make(chan int, 10), make(chan int, 10)}
+
+	h, err := NtoN(context.Background(), HashPartition(func(i int) string { return strconv.Itoa(i % 2) }), out, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 6; i++ {
+		in[0] <- i
+	}
+	close(in[0])
+	h.Wait()
+
+	// Every key must land on a single output.
+	outputOf := make(map[int]int)
+	for i, o := range out {
+		for len(o) > 0 {
+			k := <-o % 2
+			if prev, ok := outputOf[k]; ok && prev != i {
+				t.Error("key", k, "went to outputs", prev, "and", i)
+			}
+			outputOf[k] = i
+		}
+	}
+
+	if len(outputOf) != 2 {
+		t.Error("missing keys", outputOf)
+	}
+}
+
+func TestNtoNStop(t *testing.T) {
+	log.Init(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
+
+	if _, err := NtoN(context.Background(), Copy[int], nil, nil); err != load.ErrEndpoints {
+		t.Error("expected ErrEndpoints got", err)
+	}
+
+	in := []chan int{make(chan int)}
+	out := []chan int{make(chan int)}
+
+	h, err := NtoN(context.Background(), Copy[int], out, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The send to the output blocks until the handle is stopped.
+	in[0] <- 1
+	h.Stop()
+
+	select {
+	case <-h.Done():
+	case <-time.After(time.Second):
+		t.Error("NtoN did not stop")
+	}
+}
+
+func TestLeastLoaded(t *testing.T) {
+	log.Init(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
+
+	in := []chan error{make(chan error)}
+	out := []chan error{make(chan error), make(chan error, 2)}
+
+	h, err := NtoN(context.Background(), LeastLoadedTimeout[error](time.Millisecond*10), out, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The unbuffered output is never read, everything goes
+	// to the buffered one.  Once it is full the last value
+	// waits for room rather than being dropped.
+	in[0] <- nil
+	in[0] <- context.Canceled
+	in[0] <- context.DeadlineExceeded
+	time.Sleep(time.Millisecond * 30)
+
+	if <-out[1] != nil {
+		t.Error("values were not sent to the buffered output")
+	}
+
+	close(in[0])
+	h.Wait()
+
+	if len(out[1]) != 2 || <-out[1] != context.Canceled || <-out[1] != context.DeadlineExceeded {
+		t.Error("a value was dropped")
+	}
+}
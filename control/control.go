@@ -0,0 +1,184 @@
+/*
+	The control package holds the protocol a leader uses 
+	to manage its workers.  Each request carries its own 
+	ID and reply channel and travels over a control.Port, 
+	apart from the data the worker sends and receives, so 
+	any number of requests can be in flight at once.
+*/
+package control
+
+import (
+	"github.com/go-emd/emd/connector"
+	"github.com/go-emd/emd/core"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// The kind of a control request.
+type Kind string
+
+// The requests a leader sends to its workers.
+const (
+	Stop    Kind = "STOP"
+	Status  Kind = "STATUS"
+	Metrics Kind = "METRICS"
+)
+
+// The status a worker answers with when it is not healthy.
+const Unhealthy = "Unhealthy"
+
+// Returned by Ask when the connector has no channel to ask 
+// the worker over.
+var ErrNotControl = errors.New("control: connector is not a control port")
+
+// Returned by Ask when a legacy worker's answer is one of the 
+// requests, the request was read back before the worker got it.
+var ErrNoAnswer = errors.New("control: a request was read back in place of the answer")
+
+// Lets a single legacy request at a time use each channel, a 
+// request and its answer share the channel so an ask running 
+// at the same time could read either of them.
+var legacy = struct {
+	sync.Mutex
+	turns map[chan interface{}]chan struct{}
+}{turns: make(map[chan interface{}]chan struct{})}
+
+// Used to give every request a unique ID.
+var lastID uint64
+
+// A request from the leader to a worker.  The worker answers 
+// it with Respond, which sends the Response to the Reply 
+// channel of the request.
+type Request struct {
+	ID    uint64
+	Kind  Kind
+	Reply chan Response
+}
+
+// The answer of a worker to a request.  The Value is the 
+// status or metrics of the worker and is nil for a Stop.
+type Response struct {
+	ID    uint64
+	Kind  Kind
+	Value interface{}
+}
+
+// Creates a request with a new ID.  The Reply channel is 
+// buffered so a worker never blocks answering a leader that 
+// has given up waiting.
+func NewRequest(kind Kind) Request {
+	return Request{atomic.AddUint64(&lastID, 1), kind, make(chan Response, 1)}
+}
+
+// Answers the request, only the first answer is kept.
+func (r Request) Respond(value interface{}) {
+	select {
+	case r.Reply <- Response{r.ID, r.Kind, value}:
+	default:
+	}
+}
+
+// The management connector between a leader and one of its 
+// workers, the MGMT_<worker name> port.  It behaves just like 
+// a connector.Local for data while the control requests use 
+// the separate Requests channel.
+type Port struct {
+	connector.Local
+	Requests chan Request
+}
+
+// Creates a control port with the given name.
+func NewPort(name string) *Port {
+	return &Port{
+		connector.Local{Base: connector.Base{Core: core.Core{Name_: name}, Channel_: make(chan interface{})}},
+		make(chan Request),
+	}
+}
+
+// Sends a request of the kind to the worker and waits for 
+// its answer until the context is done.
+func (p *Port) Ask(ctx context.Context, kind Kind) (Response, error) {
+	req := NewRequest(kind)
+
+	select {
+	case p.Requests <- req:
+	case <-ctx.Done():
+		return Response{}, ctx.Err()
+	}
+
+	select {
+	case res := <-req.Reply:
+		return res, nil
+	case <-ctx.Done():
+		return Response{}, ctx.Err()
+	}
+}
+
+// Sends a request of the kind over the connector and waits for 
+// the answer until the context is done.
+//
+// A connector that is not a control.Port, such as the plain 
+// connector.Local MGMT ports of workers written before the 
+// control package, is asked the legacy way.  The kind is written 
+// to its channel as a string, "STOP", "STATUS" or "METRICS", and 
+// for all but a Stop the answer is read back from the channel.  
+// Only one such request at a time is sent over a channel.  Such 
+// workers should move to a control.Port, see worker.Serve.
+func Ask(ctx context.Context, c connector.Connector, kind Kind) (Response, error) {
+	if p, ok := c.(*Port); ok {
+		return p.Ask(ctx, kind)
+	}
+
+	return askLegacy(ctx, c, kind)
+}
+
+// Asks a worker over a plain connector with the string protocol 
+// of the workers predating control ports.
+func askLegacy(ctx context.Context, c connector.Connector, kind Kind) (Response, error) {
+	if c == nil {
+		return Response{}, ErrNotControl
+	}
+
+	ch := c.Channel()
+	if ch == nil {
+		return Response{}, ErrNotControl
+	}
+
+	legacy.Lock()
+	turn := legacy.turns[ch]
+	if turn == nil {
+		turn = make(chan struct{}, 1)
+		legacy.turns[ch] = turn
+	}
+	legacy.Unlock()
+
+	select {
+	case turn <- struct{}{}:
+		defer func() { <-turn }()
+	case <-ctx.Done():
+		return Response{}, ctx.Err()
+	}
+
+	select {
+	case ch <- string(kind):
+	case <-ctx.Done():
+		return Response{}, ctx.Err()
+	}
+
+	if kind == Stop {
+		return Response{Kind: kind}, nil
+	}
+
+	select {
+	case v := <-ch:
+		switch v {
+		case string(Stop), string(Status), string(Metrics):
+			return Response{}, ErrNoAnswer
+		}
+		return Response{Kind: kind, Value: v}, nil
+	case <-ctx.Done():
+		return Response{}, ctx.Err()
+	}
+}
@@ -0,0 +1,136 @@
+package control
+
+import (
+	"github.com/go-emd/emd/connector"
+	"github.com/go-emd/emd/core"
+	"github.com/go-emd/emd/log"
+	"context"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAsk(t *testing.T) {
+	log.Init(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
+
+	p := NewPort("MGMT_Test")
+
+	// A worker answering every request with its kind.
+	go func() {
+		for req := range p.Requests {
+			req.Respond(string(req.Kind))
+			req.Respond("IGNORED")
+		}
+	}()
+	defer close(p.Requests)
+
+	// Requests in flight at the same time each get their own answer.
+	var wg sync.WaitGroup
+	for _, kind := range []Kind{Status, Metrics, Stop, Status, Metrics} {
+		wg.Add(1)
+		go func(kind Kind) {
+			defer wg.Done()
+
+			res, err := Ask(context.Background(), p, kind)
+			if err != nil || res.Kind != kind || res.Value != string(kind) {
+				t.Error("unexpected answer", res, err)
+			}
+		}(kind)
+	}
+	wg.Wait()
+
+	a, b := NewRequest(Status), NewRequest(Status)
+	if a.ID == b.ID {
+		t.Error("requests share an ID")
+	}
+}
+
+func TestAskTimeout(t *testing.T) {
+	log.Init(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
+
+	p := NewPort("MGMT_Test")
+
+	// Nobody reads the requests.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+
+	if _, err := p.Ask(ctx, Status); err != context.DeadlineExceeded {
+		t.Error("expected DeadlineExceeded got", err)
+	}
+
+	// A worker that never answers.
+	go func() { <-p.Requests }()
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+
+	if _, err := p.Ask(ctx, Status); err != context.DeadlineExceeded {
+		t.Error("expected DeadlineExceeded got", err)
+	}
+
+	// A connector without a channel cannot be asked.
+	if _, err := Ask(ctx, &connector.Local{}, Status); err != ErrNotControl {
+		t.Error("expected ErrNotControl got", err)
+	}
+}
+
+func TestAskLegacy(t *testing.T) {
+	log.Init(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
+
+	mgmt := &connector.Local{Base: connector.Base{Core: core.Core{Name_: "MGMT_Legacy"}, Channel_: make(chan interface{})}}
+
+	// A worker reading its MGMT port the way workers did 
+	// before control ports.
+	stopped := make(chan bool, 1)
+	go func() {
+		for data := range mgmt.Channel() {
+			switch data {
+			case "STATUS":
+				time.Sleep(time.Millisecond)
+				mgmt.Channel() <- "Healthy"
+			case "METRICS":
+				mgmt.Channel() <- 42
+			case "STOP":
+				stopped <- true
+				return
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if res, err := Ask(ctx, mgmt, Status); err != nil || res.Value != "Healthy" {
+		t.Error("unexpected status", res, err)
+	}
+
+	if res, err := Ask(ctx, mgmt, Metrics); err != nil || res.Value != 42 {
+		t.Error("unexpected metrics", res, err)
+	}
+
+	// Asks at the same time each get their own answer.
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(kind Kind, want interface{}) {
+			defer wg.Done()
+
+			if res, err := Ask(ctx, mgmt, kind); err != nil || res.Value != want {
+				t.Error("unexpected answer to", kind, res, err)
+			}
+		}([]Kind{Status, Metrics}[i%2], []interface{}{"Healthy", 42}[i%2])
+	}
+	wg.Wait()
+
+	if _, err := Ask(ctx, mgmt, Stop); err != nil || !<-stopped {
+		t.Error("legacy worker did not stop", err)
+	}
+
+	// Nobody reads the buffered port, the request is read 
+	// back and is not taken as the answer.
+	buffered := &connector.Local{Base: connector.Base{Core: core.Core{Name_: "MGMT_Buffered"}, Channel_: make(chan interface{}, 1)}}
+	if _, err := Ask(ctx, buffered, Status); err != ErrNoAnswer {
+		t.Error("expected ErrNoAnswer got", err)
+	}
+}
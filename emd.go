@@ -107,6 +107,24 @@ func CreateLeader(lPath string, node config.NodeConfig, guiPort, cPath string) e
 	return nil
 }
 
+// request: Performs a request with the method on the REST endpoint
+// of the node leader with the scheme and credentials of the config's
+// Security.  The endpoints changing the distribution only take POST.
+func request(cfg config.Config, method, hostname, path string) (*http.Response, error) {
+	client, err := cfg.Security.Client()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(method, cfg.Security.Scheme()+"://"+hostname+":"+cfg.GUI_port+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Security.Authorize(req)
+
+	return client.Do(req)
+}
+
 // buildLeader: Runs "go build" on each node leader to get the executable.
 func BuildLeader(path, hostname string) (string, error) {
 	out, err := exec.Command("go", "build", "-o", filepath.Join(path, "bin", hostname), filepath.Join(path, hostname+".go")).CombinedOutput()
@@ -143,6 +161,45 @@ func Compile() {
 	externalPorts = make(map[string]int)
 	config.Process(filepath.Join(path, "config.json"), &cfg)
 
+	if !cfg.History.Valid() {
+		log.ERROR.Println("History needs a positive Interval, such as \"10s\", and Samples that are not negative")
+		os.Exit(1)
+	}
+
+	if !cfg.Security.Valid() {
+		log.ERROR.Println("Security needs both a Cert and Key, both a ClientCert and ClientKey, TLS for any CA and no empty Tokens")
+		os.Exit(1)
+	}
+
+	// Make sure every connection is one the leader
+	//   template is able to build and every restart
+	//   policy is one the leader knows.
+	for _, n := range cfg.Nodes {
+		for _, w := range n.Workers {
+			for _, c := range w.Connections {
+				if !c.ValidType() {
+					log.ERROR.Println("Worker " + w.Name + " has unknown connection type " + c.Type)
+					os.Exit(1)
+				}
+
+				if !c.ValidDelivery() {
+					log.ERROR.Println("Worker " + w.Name + " has connection " + c.Alias + " with delivery " + c.Delivery + " that is unknown or not External")
+					os.Exit(1)
+				}
+
+				if !c.ValidCodec() {
+					log.ERROR.Println("Worker " + w.Name + " has connection " + c.Alias + " with codec " + c.Codec + " that is unknown or not External")
+					os.Exit(1)
+				}
+			}
+
+			if !w.Valid() {
+				log.ERROR.Println("Worker " + w.Name + " has an invalid restart policy " + w.Restart)
+				os.Exit(1)
+			}
+		}
+	}
+
 	// Loop through all nodes in config and create
 	//   leader files for each, then build them
 	//   placing them into the /leaders/bin dir.
@@ -425,27 +482,40 @@ func Stop() {
 
 	log.INFO.Println("Stopping distribution")
 
+	failed := false
 	for _, n := range cfg.Nodes {
 		log.INFO.Println("Stopping node " + n.Hostname)
 
-		// Stop all the workers
-		_, err := http.Get("http://" + n.Hostname + ":" + cfg.GUI_port + "/stop")
-		if err != nil {
-			log.ERROR.Println(err)
-			os.Exit(1)
-		}
+		// Stop all the workers, then the leader which
+		//   answers once it has drained.  A leader with
+		//   no running workers stops on the first request.
+		for i := 0; i < 2; i++ {
+			resp, err := request(cfg, "POST", n.Hostname, "/stop")
+			if err != nil {
+				log.ERROR.Println(err)
+				failed = true
+				break
+			}
 
-		// Stop the leader
-		_, err = http.Get("http://" + n.Hostname + ":" + cfg.GUI_port + "/stop")
-		if err != nil {
-			if strings.Contains(err.Error(), "EOF") {
-				continue
+			content, err := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				log.ERROR.Println(err)
+				failed = true
+				break
+			}
+
+			if strings.Contains(string(content), "Leader stopped") {
+				break
 			}
-			log.ERROR.Println(err)
-			os.Exit(1)
 		}
 	}
 
+	if failed {
+		log.ERROR.Println("Stop failed on some nodes")
+		os.Exit(1)
+	}
+
 	log.INFO.Println("Stop successful")
 }
 
@@ -484,7 +554,7 @@ func Status() {
 	for _, n := range cfg.Nodes {
 		log.INFO.Println("Obtaining status of node " + n.Hostname)
 
-		resp, err := http.Get("http://" + n.Hostname + ":" + cfg.GUI_port + "/status")
+		resp, err := request(cfg, "GET", n.Hostname, "/status")
 		if err != nil {
 			log.ERROR.Println(err)
 			os.Exit(1)
@@ -537,7 +607,7 @@ func Metrics() {
 	for _, n := range cfg.Nodes {
 		log.INFO.Println("Obtaining metrics of node " + n.Hostname)
 
-		resp, err := http.Get("http://" + n.Hostname + ":" + cfg.GUI_port + "/metrics")
+		resp, err := request(cfg, "GET", n.Hostname, "/metrics")
 		if err != nil {
 			log.ERROR.Println(err)
 			os.Exit(1)
@@ -1,21 +1,155 @@
 package leader
 
 import (
+	"github.com/go-emd/emd/connector"
+	"github.com/go-emd/emd/metrics"
+	"sync"
 	"time"
 )
 
-// Structure of each worker's cache.
+// Structure of each worker's cache.  Crashes counts the 
+// panics of the worker, Reason holds the last one and 
+// Restarts counts the times the leader restarted it.  Metric 
+// is the value the worker answered its last METRICS request 
+// with, Registry the last snapshot of its metrics.Registry and 
+// Ports the last connector.Stats of each of its ports.  Only 
+// the latest values are cached, the earlier ones are kept by 
+// the leader's history.
 type WorkerCache struct {
 	Timestamp time.Time // Leader controlled
 	Metric interface{}
+	Registry metrics.Snapshot // Leader controlled
+	Ports map[string]connector.Stats // Leader controlled
 	Status string
 	Health string
 	State string // Leader controlled
+	Crashes int // Leader controlled
+	Restarts int // Leader controlled
+	Reason string // Leader controlled
 }
 
 // Structure of the cache that the leader maintains 
 // and sends back in response to a REST endpoint 
-// request of cache.
+// request of cache.  It holds the workers of the node and 
+// the liveness of the other node leaders, its peers.  It 
+// is safe to use from several go routines through its 
+// methods.
 type Cache struct {
 	Workers map[string]WorkerCache
+	Peers   map[string]PeerStatus
+
+	mu         sync.RWMutex
+	notify     func(name string, before, after WorkerCache)
+	notifyPeer func(hostname string, before, after PeerStatus)
+}
+
+// Creates a cache with an initialized entry for 
+// each of the named workers.
+func newCache(names []string) *Cache {
+	c := &Cache{
+		Workers: make(map[string]WorkerCache, len(names)),
+		Peers: make(map[string]PeerStatus),
+	}
+
+	for _, name := range names {
+		c.Workers[name] = WorkerCache{
+			Timestamp: time.Now(),
+			Health: "Unknown",
+			State: "Initialized",
+			Status: "Unknown",
+		}
+	}
+
+	return c
+}
+
+// Returns a copy of the named worker's entry.
+func (c *Cache) Get(name string) (WorkerCache, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	w, ok := c.Workers[name]
+	return w, ok
+}
+
+// Changes the named worker's entry with f and 
+// stamps it with the current time.  The notify func, 
+// when set, is told about the change in the order the 
+// changes are made.
+func (c *Cache) Update(name string, f func(*WorkerCache)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	before := c.Workers[name]
+	w := before
+	f(&w)
+	w.Timestamp = time.Now()
+	c.Workers[name] = w
+
+	if c.notify != nil {
+		c.notify(name, before, w)
+	}
+}
+
+// Returns a copy of the named peer's entry.
+func (c *Cache) Peer(hostname string) (PeerStatus, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	p, ok := c.Peers[hostname]
+	return p, ok
+}
+
+// Changes the named peer's entry with f, the notifyPeer 
+// func, when set, is told about the change.
+func (c *Cache) UpdatePeer(hostname string, f func(*PeerStatus)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	before := c.Peers[hostname]
+	p := before
+	f(&p)
+	c.Peers[hostname] = p
+
+	if c.notifyPeer != nil {
+		c.notifyPeer(hostname, before, p)
+	}
+}
+
+// Returns a copy of the whole cache that can be 
+// read or serialized while the cache keeps changing.
+func (c *Cache) Snapshot() *Cache {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	s := &Cache{
+		Workers: make(map[string]WorkerCache, len(c.Workers)),
+		Peers: make(map[string]PeerStatus, len(c.Peers)),
+	}
+	for k, v := range c.Workers {
+		s.Workers[k] = v
+	}
+	for k, v := range c.Peers {
+		s.Peers[k] = v
+	}
+
+	return s
+}
+
+// Returns the names of the workers whose state is not 
+// the given state.  This is used by the leader.Start and 
+// leader.Stop functions to tell which workers need to be 
+// started or stopped.
+func (c *Cache) without(state string) []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var names []string
+	for k, v := range c.Workers {
+		if v.State != state {
+			names = append(names, k)
+		}
+	}
+
+	return names
 }
@@ -0,0 +1,194 @@
+package leader
+
+import (
+	"github.com/go-emd/emd/log"
+	"github.com/go-emd/emd/metrics"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long the leader waits for the other node leaders to
+// answer a cluster request.
+var clusterTimeout = time.Second * 5
+
+// The answer of a single node leader to a cluster request.
+// A node is Reachable when its leader answered at all, the
+// Success and Message are then those of its answer and the
+// LatencyMs is how long it took.  The Error tells why a node
+// is not reachable or its answer could not be read.
+type NodeAnswer struct {
+	Reachable bool
+	LatencyMs float64
+	Error     string          `json:",omitempty"`
+	Success   bool
+	Message   json.RawMessage `json:",omitempty"`
+}
+
+// A REST endpoint giving the view of the whole distribution
+// from any of its leaders.  The path is of the form
+// /cluster/{status|metrics|cache}, every node leader of the
+// config is asked for its own /status, /metrics or /cache at
+// once and their answers are listed under Nodes along with how
+// many of them were Reachable.  The status adds the worst
+// Health of the nodes, an unreachable node being Unknown, and
+// the metrics add the registries of every node merged into
+// Cluster.  The request only succeeds when every node answered
+// with success.
+func (l *Lead) Cluster(rw http.ResponseWriter, r *http.Request) {
+	kind := strings.Trim(strings.TrimPrefix(r.URL.Path, "/cluster/"), "/")
+	if kind != "status" && kind != "metrics" && kind != "cache" {
+		Respond(rw, false, "Usage: /cluster/{status|metrics|cache}")
+		return
+	}
+
+	nodes := l.askNodes(r.Context(), "/"+kind)
+
+	success := true
+	reachable := 0
+	for _, a := range nodes {
+		if a.Reachable {
+			reachable++
+		}
+		success = success && a.Success
+	}
+
+	message := map[string]interface{}{
+		"Nodes": nodes,
+		"Reachable": reachable,
+		"Unreachable": len(nodes) - reachable,
+	}
+
+	switch kind {
+	case "status":
+		message["Health"] = clusterHealth(nodes)
+	case "metrics":
+		message["Cluster"] = clusterMetrics(nodes)
+	}
+
+	Respond(rw, success, message)
+	return
+}
+
+// Asks every node leader of the config for the path at once
+// and returns their answers by hostname.
+func (l *Lead) askNodes(ctx context.Context, path string) map[string]NodeAnswer {
+	answers := make(map[string]NodeAnswer, len(l.Nodes))
+
+	client, err := l.Security.Client()
+	if err != nil {
+		log.ERROR.Println(err)
+
+		for _, n := range l.Nodes {
+			answers[n.Hostname] = NodeAnswer{Error: err.Error()}
+		}
+		return answers
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, clusterTimeout)
+	defer cancel()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, n := range l.Nodes {
+		wg.Add(1)
+		go func(hostname string) {
+			defer wg.Done()
+
+			a := l.askNode(ctx, client, hostname, path)
+
+			mu.Lock()
+			answers[hostname] = a
+			mu.Unlock()
+		}(n.Hostname)
+	}
+
+	wg.Wait()
+	return answers
+}
+
+// Asks a single node leader for the path with the credentials
+// of the Security.
+func (l *Lead) askNode(ctx context.Context, client *http.Client, hostname, path string) (a NodeAnswer) {
+	start := time.Now()
+	defer func() {
+		a.LatencyMs = float64(time.Since(start)) / float64(time.Millisecond)
+	}()
+
+	url := l.Security.Scheme() + "://" + net.JoinHostPort(hostname, l.GUI_port) + path
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		a.Error = err.Error()
+		return
+	}
+	l.Security.Authorize(req)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		a.Error = err.Error()
+		return
+	}
+	defer resp.Body.Close()
+
+	a.Reachable = true
+
+	var res struct {
+		Success bool
+		Message json.RawMessage
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		a.Error = "Unable to read the answer: " + err.Error()
+		return
+	}
+
+	a.Success, a.Message = res.Success, res.Message
+	return
+}
+
+// Returns the worst health of the nodes' status answers.
+func clusterHealth(nodes map[string]NodeAnswer) string {
+	health := "Healthy"
+
+	for _, a := range nodes {
+		var status struct {
+			Health string
+		}
+
+		if !a.Reachable || json.Unmarshal(a.Message, &status) != nil || status.Health == "" {
+			status.Health = "Unknown"
+		}
+
+		health = worse(health, status.Health)
+	}
+
+	return health
+}
+
+// Merges the registries of the nodes' metrics answers.
+func clusterMetrics(nodes map[string]NodeAnswer) metrics.Snapshot {
+	snapshots := make([]metrics.Snapshot, 0, len(nodes))
+
+	for _, a := range nodes {
+		var m struct {
+			Node metrics.Snapshot
+		}
+
+		if a.Reachable && json.Unmarshal(a.Message, &m) == nil {
+			snapshots = append(snapshots, m.Node)
+		}
+	}
+
+	cluster, err := metrics.Merge(snapshots...)
+	if err != nil {
+		log.WARNING.Println("Unable to merge the metrics of every node: " + err.Error())
+	}
+
+	return cluster
+}
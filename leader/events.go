@@ -0,0 +1,271 @@
+package leader
+
+import (
+	"github.com/go-emd/emd/connector"
+	"github.com/go-emd/emd/metrics"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// How many events the leader keeps for clients resuming with
+// Last-Event-ID, how many may wait for a single client before
+// it is disconnected, how often the metrics are published and
+// how often an idle stream is kept alive.
+var (
+	eventHistory   = 1024
+	eventBuffer    = 64
+	eventInterval  = time.Second * 10
+	eventKeepAlive = time.Second * 15
+)
+
+// The kinds of events the leader publishes.
+const (
+	EventState     = "State"
+	EventHealth    = "Health"
+	EventCrash     = "Crash"
+	EventRestart   = "Restart"
+	EventConnector = "Connector"
+	EventMetrics   = "Metrics"
+	EventPeer      = "Peer"
+)
+
+// A change the leader pushes to the clients of /events.  The
+// IDs only go up so a client can resume after the last event
+// it saw, the Worker is empty for events about the whole node.
+type Event struct {
+	ID     uint64
+	Time   time.Time
+	Kind   string
+	Worker string `json:",omitempty"`
+	Data   interface{}
+}
+
+// Hands every event published to the subscribed clients and
+// keeps the last limit of them.
+type events struct {
+	mu          sync.Mutex
+	last        uint64
+	limit       int
+	history     []Event
+	subscribers map[chan Event]bool
+	closed      bool
+}
+
+// Creates an empty event stream keeping the last eventHistory
+// events.
+func newEvents() *events {
+	return &events{limit: eventHistory, subscribers: make(map[chan Event]bool)}
+}
+
+// Publishes an event to every subscriber.  A subscriber that
+// is too far behind is dropped, its channel is closed and the
+// client can resume from the history.
+func (e *events) publish(kind, worker string, data interface{}) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.last += 1
+	ev := Event{e.last, time.Now(), kind, worker, data}
+
+	if len(e.history) >= e.limit {
+		n := copy(e.history, e.history[len(e.history)-e.limit+1:])
+		e.history = e.history[:n]
+	}
+	e.history = append(e.history, ev)
+
+	for ch := range e.subscribers {
+		select {
+		case ch <- ev:
+		default:
+			delete(e.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribes to the events published from now on.  Returns
+// the events of the history after the given ID as well, the
+// channel is closed right away once the events are closed.
+func (e *events) subscribe(after uint64) ([]Event, chan Event) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var backlog []Event
+	for _, ev := range e.history {
+		if ev.ID > after {
+			backlog = append(backlog, ev)
+		}
+	}
+
+	ch := make(chan Event, eventBuffer)
+	if e.closed {
+		close(ch)
+	} else {
+		e.subscribers[ch] = true
+	}
+
+	return backlog, ch
+}
+
+// Stops handing events to the channel.
+func (e *events) unsubscribe(ch chan Event) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.subscribers[ch] {
+		delete(e.subscribers, ch)
+		close(ch)
+	}
+}
+
+// Closes every subscriber so the streams end, used when the
+// leader exits.
+func (e *events) close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.closed = true
+	for ch := range e.subscribers {
+		delete(e.subscribers, ch)
+		close(ch)
+	}
+}
+
+// A REST endpoint that streams the events of the leader as
+// Server-Sent Events.  Each event carries its ID and its kind
+// and the Event as json data.  A client sending the
+// Last-Event-ID header first gets the events after it that
+// are still in the history.  The stream ends when the leader
+// exits or when the client falls too far behind, the client
+// then reconnects with the last ID it saw.
+func (l *Lead) Events(rw http.ResponseWriter, r *http.Request) {
+	flusher, ok := rw.(http.Flusher)
+	if !ok {
+		Respond(rw, false, "Streaming is not supported.")
+		return
+	}
+
+	var last uint64
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		last, _ = strconv.ParseUint(id, 10, 64)
+	}
+
+	backlog, ch := l.events.subscribe(last)
+	defer l.events.unsubscribe(ch)
+
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-cache")
+	rw.Header().Set("Connection", "keep-alive")
+	rw.WriteHeader(http.StatusOK)
+
+	for _, ev := range backlog {
+		writeEvent(rw, ev)
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case ev, ok := <-ch:
+			if !ok {
+				return
+			}
+			writeEvent(rw, ev)
+		case <-keepAlive.C:
+			fmt.Fprint(rw, ": keep-alive\n\n")
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// Writes a single event in the text/event-stream format.
+func writeEvent(rw http.ResponseWriter, ev Event) {
+	b, err := json.Marshal(ev)
+	if err != nil {
+		b, _ = json.Marshal(Event{ev.ID, ev.Time, ev.Kind, ev.Worker, err.Error()})
+	}
+
+	fmt.Fprintf(rw, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Kind, b)
+}
+
+// Publishes the changes of a worker's cache entry, called by
+// the cache on every update.
+func (l *Lead) changed(name string, before, after WorkerCache) {
+	if before.State != after.State {
+		l.events.publish(EventState, name, map[string]string{"From": before.State, "To": after.State})
+	}
+
+	if before.Health != after.Health {
+		l.events.publish(EventHealth, name, map[string]string{"From": before.Health, "To": after.Health})
+	}
+
+	if after.Crashes > before.Crashes {
+		l.events.publish(EventCrash, name, map[string]interface{}{"Crashes": after.Crashes, "Reason": after.Reason})
+	}
+
+	if after.Restarts > before.Restarts {
+		l.events.publish(EventRestart, name, map[string]int{"Restarts": after.Restarts})
+	}
+}
+
+// Publishes the metrics of every worker each eventInterval
+// along with the errors the connectors ran into since the
+// last time, until the leader exits.
+func (l *Lead) watch() {
+	ticker := time.NewTicker(eventInterval)
+	defer ticker.Stop()
+
+	previous := make(map[string]map[string]connector.Stats)
+
+	for {
+		select {
+		case <-ticker.C:
+			previous = l.publishMetrics(previous)
+		case <-l.exiting():
+			return
+		}
+	}
+}
+
+// Publishes a Connector event for every port whose errors
+// went up since the previous stats and a Metrics event with
+// the registries and ports of every worker.  Returns the
+// current stats.
+func (l *Lead) publishMetrics(previous map[string]map[string]connector.Stats) map[string]map[string]connector.Stats {
+	registries := make(map[string]metrics.Snapshot)
+	ports := make(map[string]map[string]connector.Stats)
+
+	for _, w := range l.Workers {
+		name := w.Name()
+		registries[name] = l.registry(name)
+		ports[name] = l.portStats(name)
+
+		for _, p := range sortedKeys(ports[name]) {
+			s, before := ports[name][p], previous[name][p]
+
+			if s.EncodeErrors > before.EncodeErrors || s.DecodeErrors > before.DecodeErrors || s.Dropped > before.Dropped {
+				l.events.publish(EventConnector, name, map[string]interface{}{
+					"Port": p,
+					"EncodeErrors": s.EncodeErrors - before.EncodeErrors,
+					"DecodeErrors": s.DecodeErrors - before.DecodeErrors,
+					"Dropped": s.Dropped - before.Dropped,
+				})
+			}
+		}
+	}
+
+	l.events.publish(EventMetrics, "", map[string]interface{}{
+		"Registries": registries,
+		"Ports": ports,
+	})
+
+	return ports
+}
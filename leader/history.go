@@ -0,0 +1,268 @@
+package leader
+
+import (
+	"github.com/go-emd/emd/connector"
+	"github.com/go-emd/emd/control"
+	"github.com/go-emd/emd/metrics"
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The most samples of a worker /metrics/history answers with
+// unless asked for a step or for more points.
+var historyPoints = 500
+
+// The metrics of a worker at one point in time.  Metric is
+// what the worker answered its METRICS request with and is
+// nil when the worker was not running.
+type Sample struct {
+	Time     time.Time
+	Metric   interface{}                `json:",omitempty"`
+	Registry metrics.Snapshot
+	Ports    map[string]connector.Stats
+}
+
+// A ring of the last samples of a worker.
+type ring struct {
+	samples []Sample
+	next    int
+}
+
+// Keeps the last limit samples of every worker, the oldest
+// sample of a worker being overwritten once it has limit of
+// them.
+type history struct {
+	mu    sync.RWMutex
+	limit int
+	rings map[string]*ring
+}
+
+// Creates an empty history keeping limit samples per worker.
+func newHistory(limit int) *history {
+	return &history{limit: limit, rings: make(map[string]*ring)}
+}
+
+// Adds a sample of the named worker.
+func (h *history) add(name string, s Sample) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	r := h.rings[name]
+	if r == nil {
+		r = &ring{}
+		h.rings[name] = r
+	}
+
+	if len(r.samples) < h.limit {
+		r.samples = append(r.samples, s)
+		return
+	}
+
+	r.samples[r.next] = s
+	r.next = (r.next + 1) % h.limit
+}
+
+// Returns the samples of the named worker taken after since,
+// oldest first.
+func (h *history) since(name string, since time.Time) []Sample {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	samples := []Sample{}
+
+	r := h.rings[name]
+	if r == nil {
+		return samples
+	}
+
+	for i := range r.samples {
+		s := r.samples[(r.next+i)%len(r.samples)]
+		if s.Time.After(since) {
+			samples = append(samples, s)
+		}
+	}
+
+	return samples
+}
+
+// Samples the metrics of every worker each History interval
+// until the leader exits.
+func (l *Lead) sample() {
+	ticker := time.NewTicker(l.History.Period())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			l.record(time.Now())
+		case <-l.exiting():
+			return
+		}
+	}
+}
+
+// Adds a sample of every worker to the history.  Only the
+// running workers are asked for their metrics, the registry
+// and ports of the others are still sampled.
+func (l *Lead) record(now time.Time) {
+	var running []string
+	for name := range l.Ports {
+		if c, _ := l.cache.Get(name); c.State == "Running" {
+			running = append(running, name)
+		}
+	}
+
+	values := make(map[string]interface{})
+	for k, a := range l.askEach(context.Background(), control.Metrics, running) {
+		values[k] = l.metrics(a)
+	}
+
+	for name := range l.Ports {
+		l.history.add(name, Sample{
+			Time: now,
+			Metric: values[name],
+			Registry: l.registry(name),
+			Ports: l.portStats(name),
+		})
+	}
+}
+
+// A REST endpoint that returns the samples the leader took of
+// its workers' metrics, the worker query parameter limiting it
+// to a single worker.  The since parameter only keeps the
+// samples after a time, either RFC 3339, seconds since the
+// epoch or a duration such as 15m before now.
+//
+// The samples are downsampled to a sample per step, the last
+// one of the step with its gauges averaged over the step.  The
+// step is either the step parameter, such as 1m, or the one
+// giving at most the points parameter of samples, 500 by
+// default.
+func (l *Lead) MetricsHistory(rw http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	var since time.Time
+	if v := q.Get("since"); v != "" {
+		var ok bool
+		if since, ok = parseSince(v, time.Now()); !ok {
+			Respond(rw, false, "Invalid since " + v + ".")
+			return
+		}
+	}
+
+	var step time.Duration
+	if v := q.Get("step"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			Respond(rw, false, "Invalid step " + v + ".")
+			return
+		}
+		step = d
+	}
+
+	points := historyPoints
+	if v := q.Get("points"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			Respond(rw, false, "Invalid points " + v + ".")
+			return
+		}
+		points = n
+	}
+
+	names := []string{q.Get("worker")}
+	if names[0] == "" {
+		names = sortedKeys(l.Ports)
+	} else if l.Ports[names[0]] == nil {
+		Respond(rw, false, "Unknown worker " + names[0] + ".")
+		return
+	}
+
+	workers := make(map[string][]Sample, len(names))
+	for _, name := range names {
+		samples := l.history.since(name, since)
+
+		s := step
+		if s == 0 && len(samples) > points {
+			s = samples[len(samples)-1].Time.Sub(samples[0].Time)/time.Duration(points) + 1
+		}
+
+		workers[name] = downsample(samples, s)
+	}
+
+	Respond(rw, true, map[string]interface{}{
+		"Interval": l.History.Period().String(),
+		"Workers": workers,
+	})
+	return
+}
+
+// Parses the since parameter of /metrics/history.
+func parseSince(v string, now time.Time) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, true
+	}
+
+	// A plain number is seconds since the epoch, never a 
+	// duration such as "0".
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(n, 0), true
+	}
+
+	if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+		return now.Add(-d), true
+	}
+
+	return time.Time{}, false
+}
+
+// Downsamples the samples to at most one per step, starting
+// from the first one.  Counters, histograms and ports only go
+// up so the last sample of a step holds them, while the gauges
+// are averaged over the step.
+func downsample(samples []Sample, step time.Duration) []Sample {
+	if step <= 0 || len(samples) == 0 {
+		return samples
+	}
+
+	var out []Sample
+	start := 0
+
+	for i := 1; i <= len(samples); i++ {
+		if i < len(samples) && samples[i].Time.Sub(samples[start].Time) < step {
+			continue
+		}
+
+		out = append(out, merge(samples[start:i]))
+		start = i
+	}
+
+	return out
+}
+
+// Merges the samples of a step into its last sample with the
+// gauges averaged.
+func merge(samples []Sample) Sample {
+	s := samples[len(samples)-1]
+	if len(samples) == 1 {
+		return s
+	}
+
+	gauges := make(map[string]float64, len(s.Registry.Gauges))
+	for k := range s.Registry.Gauges {
+		n := 0
+		for _, o := range samples {
+			if v, ok := o.Registry.Gauges[k]; ok {
+				gauges[k] += v
+				n++
+			}
+		}
+		gauges[k] /= float64(n)
+	}
+
+	s.Registry.Gauges = gauges
+	return s
+}
@@ -8,24 +8,59 @@
 package leader
 
 import (
+	"github.com/go-emd/emd/config"
 	"github.com/go-emd/emd/connector"
+	"github.com/go-emd/emd/connector/load"
+	"github.com/go-emd/emd/control"
 	"github.com/go-emd/emd/core"
 	"github.com/go-emd/emd/log"
+	"github.com/go-emd/emd/metrics"
 	"github.com/go-emd/emd/worker"
+	"context"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
 	"encoding/json"
 	"io/ioutil"
 	"time"
 )
 
-// The cache.Cache variable keeps a constant rolling cache 
-// of each job/connection's metrics, status, state, and when 
-// the last time was it was updated.
+// How long the leader waits for its workers to answer a 
+// control request and, once a worker answered a stop, for 
+// its Run to return before it is started again.
 var (
-	cache *Cache
+	controlTimeout = time.Second * 2
+	returnTimeout  = time.Second * 5
 )
 
+// How long the leader waits, when it exits, for the data 
+// already in its connectors to be processed and for the 
+// REST server to finish the requests it is handling.
+var (
+	drainTimeout    = time.Second * 5
+	shutdownTimeout = time.Second * 10
+)
+
+// The health of a single worker as returned by the status 
+// request.  The Reason tells why a worker is not Healthy and 
+// the LatencyMs is how long it took the worker to answer.
+type WorkerStatus struct {
+	Health    string
+	Reason    string
+	LatencyMs float64
+}
+
+// The answer of a single worker to a control request.
+type answer struct {
+	name     string
+	response control.Response
+	err      error
+	latency  time.Duration
+}
+
 // Every leader must implement the leader.Leader interface 
 // allowing it to initialize, run, exit and handle REST 
 // requests.
@@ -40,85 +75,292 @@ type Leader interface {
 	Metrics(http.ResponseWriter, *http.Request)
 	Cache(http.ResponseWriter, *http.Request)
 	Config(http.ResponseWriter, *http.Request)
+	Worker(http.ResponseWriter, *http.Request)
+	Prometheus(http.ResponseWriter, *http.Request)
+	Events(http.ResponseWriter, *http.Request)
+	UI(http.ResponseWriter, *http.Request)
+	Cluster(http.ResponseWriter, *http.Request)
+	Heartbeat(http.ResponseWriter, *http.Request)
+	Peers(http.ResponseWriter, *http.Request)
+	MetricsHistory(http.ResponseWriter, *http.Request)
 }
 
+// Builds one of the routes forwarding data between the 
+// connectors of the leader, usually with load.NtoN.  The 
+// route must stop once the context is done.
+type Route func(ctx context.Context) (*load.Handle, error)
+
 // Each leader implementation must inherit the leader.Lead 
 // struct to get information such as its name, the REST 
 // ports to listen on, configuration file path, the workers 
 // its supposed to monitor and maintain and the management 
-// connections (or ports) the leader has with each worker.
+// connections (or ports) the leader has with each worker.  
+// The Routes forward data between the workers and are torn 
+// down and rebuilt as the workers are stopped and started.  
+// Each worker is supervised, when it panics or returns it is 
+// restarted according to its entry in the Policies, workers 
+// without an entry are never restarted.
+//
+// The leader keeps a constant rolling cache of each worker's 
+// metrics, status, state, and when the last time was it was 
+// updated, along with the liveness of its peers, the other 
+// node leaders, learned from the heartbeats they exchange.  
+// Every change to the cache is also published as an Event to 
+// the clients of /events and to the Subscribe channels.
+//
+// The Security secures the REST endpoints, the Nodes are the 
+// node leaders of the whole distribution and the History is 
+// how often the metrics of the workers are sampled and how 
+// many of the samples are kept.  They are read from the config 
+// file at the ConfigPath when left empty, as are the Policies 
+// from the restart policy of each worker.
 type Lead struct {
 	core.Core
 	GUI_port string
 	ConfigPath string
+	Security config.Security
+	Nodes    []config.NodeConfig
+	History  config.History
 	Workers  []worker.Worker
 	Ports    map[string]connector.Connector
+	Routes   []Route
+	Policies map[string]Policy
+
+	mu          sync.Mutex
+	cache       *Cache
+	events      *events
+	history     *history
+	routes      []*load.Handle
+	supervisors map[string]*supervisor
+	server      *http.Server
+	exit        chan struct{}
+	exitOnce    sync.Once
+	exitClose   sync.Once
+	done        chan struct{}
+	doneOnce    sync.Once
+	drainOnce   sync.Once
 }
 
 // Initializes the leader and each of its workers, 
-// creates a new cache and initializes each entry.
+// creates a new cache and initializes each entry.  The 
+// metrics.Registry of each worker is created before any of 
+// them runs.
 func (l *Lead) Init() {
+	if l.ConfigPath != "" {
+		var cfg config.Config
+		config.Process(l.ConfigPath, &cfg)
+		l.configure(cfg)
+	}
+
 	for _, w := range l.Workers {
 		w.Init()
+
+		if i, ok := w.(worker.Instrumented); ok {
+			i.Metrics()
+		}
 	}
 
-	cache = new(Cache)
-	cache.Workers = make(map[string]WorkerCache, len(l.Ports))
+	names := make([]string, 0, len(l.Ports))
 	for k, _ := range l.Ports {
-		tmp := cache.Workers[k]
-		tmp.Timestamp = time.Now()
-		tmp.Health = "Unknown"
-		tmp.State = "Initialized"
-		tmp.Status = "Unknown"
-		tmp.Metric = nil
+		names = append(names, k)
+	}
 
-		cache.Workers[k] = tmp
+	l.events = newEvents()
+	l.history = newHistory(l.History.Limit())
+	l.cache = newCache(names)
+	for _, hostname := range l.peers() {
+		l.cache.Peers[hostname] = PeerStatus{State: PeerUnknown}
 	}
+	l.cache.notify = l.changed
+	l.cache.notifyPeer = l.peerChanged
 
 	log.INFO.Println("Leader: " + l.Name_ + " is initialized.")
 }
 
+// Fills the Security, Nodes, History and Policies the leader 
+// was not given from the config.  The Policies are those of 
+// the leader's workers.  It runs before the workers are 
+// initialized so the Local connections they share can be 
+// split, see splitLocal.
+func (l *Lead) configure(cfg config.Config) {
+	if l.Security.IsZero() {
+		l.Security = cfg.Security
+	}
+
+	if l.Nodes == nil {
+		l.Nodes = cfg.Nodes
+	}
+
+	if l.History == (config.History{}) {
+		l.History = cfg.History
+	}
+
+	if l.Policies == nil {
+		l.Policies = make(map[string]Policy)
+
+		for _, n := range cfg.Nodes {
+			for _, w := range n.Workers {
+				if l.worker(w.Name) != nil {
+					l.Policies[w.Name] = NewPolicy(w)
+				}
+			}
+		}
+	}
+
+	for _, n := range cfg.Nodes {
+		for _, w := range n.Workers {
+			for _, c := range w.Connections {
+				if c.Type == config.LocalIngress {
+					l.splitLocal(w.Name, c.Alias)
+				}
+			}
+		}
+	}
+}
+
+// Gives the receiving worker of a connector.Local it shares 
+// with another worker, the port named alias, an Ingress of 
+// its own so the values going across it are counted.
+func (l *Lead) splitLocal(name, alias string) {
+	w := l.worker(name)
+	if w == nil {
+		return
+	}
+
+	shared, ok := w.Ports()[alias].(*connector.Local)
+	if !ok {
+		return
+	}
+
+	for _, o := range l.Workers {
+		if o == w {
+			continue
+		}
+
+		for _, p := range o.Ports() {
+			if p == connector.Connector(shared) {
+				w.Ports()[alias] = shared.Ingress(shared.Name_)
+				return
+			}
+		}
+	}
+}
+
 // Starts each worker in its own separate go routine and 
 // spins up the REST server to handle monitoring and metrics 
-// requests.
+// requests.  It returns once the leader has exited, either 
+// through a second stop request or a SIGTERM or SIGINT.  It 
+// returns without starting anything when the Security or the 
+// History is invalid.
 func (l *Lead) Run() {
 	log.INFO.Println("Leader: " + l.Name_ + " is running...")
 
-	// Start all the workers
+	if !l.Security.Valid() {
+		log.ERROR.Println("Leader: " + l.Name_ + " has an invalid security config.")
+		return
+	}
+
+	if !l.History.Valid() {
+		log.ERROR.Println("Leader: " + l.Name_ + " has an invalid history config.")
+		return
+	}
+
+	tlsConfig, err := l.tlsConfig()
+	if err != nil {
+		log.ERROR.Println(err)
+		return
+	}
+
+	// Start routing between the workers then start 
+	//   all the workers.
+	l.mu.Lock()
+	l.startRoutes()
+
 	for _, w := range l.Workers {
-		go w.Run()
-		tmp := cache.Workers[w.Name()]
-		tmp.State = "Running"
-		tmp.Timestamp = time.Now()
-		cache.Workers[w.Name()] = tmp
+		l.startWorker(w)
 	}
+	l.mu.Unlock()
 
 	// Handle rest calls and continue managing nodes
 	//   workers.
-	http.HandleFunc("/start", l.Start)
-	http.HandleFunc("/stop", l.Stop)
-	http.HandleFunc("/status", l.Status)
-	http.HandleFunc("/metrics", l.Metrics)
-	http.HandleFunc("/cache", l.Cache)
-	http.HandleFunc("/config", l.Config)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/start", l.Start)
+	mux.HandleFunc("/stop", l.Stop)
+	mux.HandleFunc("/status", l.Status)
+	mux.HandleFunc("/metrics", l.Metrics)
+	mux.HandleFunc("/cache", l.Cache)
+	mux.HandleFunc("/config", l.Config)
+	mux.HandleFunc("/workers/", l.Worker)
+	mux.HandleFunc("/metrics/prometheus", l.Prometheus)
+	mux.HandleFunc("/metrics/history", l.MetricsHistory)
+	mux.HandleFunc("/events", l.Events)
+	mux.HandleFunc("/ui/", l.UI)
+	mux.HandleFunc("/cluster/", l.Cluster)
+	mux.HandleFunc("/heartbeat", l.Heartbeat)
+	mux.HandleFunc("/peers", l.Peers)
+
+	l.mu.Lock()
+	l.server = &http.Server{Addr: ":" + l.GUI_port, Handler: l.cors(mux), TLSConfig: tlsConfig}
+	l.mu.Unlock()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(signals)
 
-	http.ListenAndServe(":"+l.GUI_port, nil)
+	served := make(chan error, 1)
+	go func() {
+		if l.Security.TLS() {
+			served <- l.server.ListenAndServeTLS(l.Security.Cert, l.Security.Key)
+			return
+		}
+
+		served <- l.server.ListenAndServe()
+	}()
+	go l.watch()
+	go l.heartbeats()
+	go l.sample()
+
+	select {
+	case sig := <-signals:
+		log.INFO.Println("Leader: " + l.Name_ + " received " + sig.String() + ".")
+	case <-l.exiting():
+	case err := <-served:
+		log.ERROR.Println(err)
+	}
+
+	l.Exit()
 }
 
-// A REST endpoint that will handle the status request and 
-// respond with the health of each worker in the node.
+// A REST endpoint, POST only, that will start every worker 
+// of the node that is not already running.  The request fails with the 
+// names of the workers that failed to start, if any.
 func (l *Lead) Start(rw http.ResponseWriter, r *http.Request) {
-	if allWorkersStopped() {
+	if !l.post(rw, r) || !l.authorize(rw, r) {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.cache.without("Running")) > 0 {
 		log.INFO.Println("Leader: " + l.Name_ + " is starting it' workers...")
 
+		l.startRoutes()
+
+		var failed []string
 		for _, w := range l.Workers {
-			w.Init()
-			go w.Run()
+			if c, _ := l.cache.Get(w.Name()); c.State == "Running" {
+				continue
+			}
+
+			if !l.rerun(w) {
+				failed = append(failed, w.Name())
+			}
+		}
 
-			tmp := cache.Workers[w.Name()]
-			tmp.State = "Running"
-			tmp.Timestamp = time.Now()
-			cache.Workers[w.Name()] = tmp
+		if len(failed) > 0 {
+			Respond(rw, false, "Workers failed to start: " + strings.Join(failed, ", ") + ".")
+			return
 		}
 
 		Respond(rw, true, "Workers started :-)")
@@ -130,127 +372,215 @@ func (l *Lead) Start(rw http.ResponseWriter, r *http.Request) {
 	return
 }
 
-// A REST endpoint that handles the stop request.  It will 
+// A REST endpoint, POST only, that handles the stop request.  It will 
 // stop all the workers in the node and when a second stop 
 // request happens the node leader will exit if all the workers 
 // are already stopped.
 func (l *Lead) Stop(rw http.ResponseWriter, r *http.Request) {
-	if !allWorkersStopped() {
+	if !l.post(rw, r) || !l.authorize(rw, r) {
+		return
+	}
+
+	l.mu.Lock()
+
+	if names := l.cache.without("Stopped"); len(names) > 0 {
+		defer l.mu.Unlock()
+
 		log.INFO.Println("Leader: " + l.Name_ + " is stopping...")
 
-		for k, v := range l.Ports {
+		for _, k := range names {
 			log.INFO.Println("Worker: " + k + "is stopping...")
-			
-			tmp := cache.Workers[k]
-			
-			if writeChannel(v.Channel(), "STOP"){
-				tmp.State = "Stopped"
-			} else {
-				log.WARNING.Println("Unable to stop worker " + k)
-				tmp.State = "Unknown"
-			}
+		}
 
-			tmp.Timestamp = time.Now()
-			cache.Workers[k] = tmp
+		for _, a := range l.askEach(r.Context(), control.Stop, l.halt(names)) {
+			l.stopped(a)
 		}
+
+		l.stopRoutes()
 	} else {
-		// Response won't return since the server is being shutdown.
-		//Respond(rw, true, "Leader stopped :-(")
-		l.Exit()
+		l.mu.Unlock()
+
+		// Run drains the leader on its way out, answer 
+		//   once it has and before the server shuts down.
+		l.exitClose.Do(func() { close(l.exiting()) })
+
+		select {
+		case <-l.exited():
+			Respond(rw, true, "Leader stopped :-(")
+		case <-r.Context().Done():
+		}
+		return
 	}
 
 	Respond(rw, true, "Workers stopped :-(")
 	return
 }
 
-// A REST endpoint that handles the status request, it will 
-// return each workers status depending on if the timeout 
-// of two seconds happens then it will send the Unknown 
-// status.
+// A REST endpoint that handles the status request.  Every 
+// worker is asked at once and the response lists the status 
+// of each of them, a worker that does not answer within two 
+// seconds is Unknown.  The overall health is the worst health 
+// of any worker and the request only succeeds when all of them 
+// answered.
 func (l *Lead) Status(rw http.ResponseWriter, r *http.Request) {
-	for k, v := range l.Ports {
-		tmp := cache.Workers[k]
-		var status interface{}
+	health := "Healthy"
+	workers := make(map[string]WorkerStatus, len(l.Ports))
 
-		if writeChannel(v.Channel(), "STATUS") {
-			if status = readChannel(v.Channel()); status == nil {
-				log.WARNING.Println("Unable to retrieve status of " + k)
+	for k, a := range l.askAll(r.Context(), control.Status) {
+		status := l.status(a)
+		health = worse(health, status.Health)
+		workers[k] = status
+	}
 
-				tmp.Health = "Unknown"
-				tmp.Timestamp = time.Now()
-				tmp.State = "Unknown"
-				cache.Workers[k] = tmp
+	Respond(rw, health != "Unknown", map[string]interface{}{
+		"Health": health,
+		"Workers": workers,
+	})
+	return
+}
 
-				Respond(rw, false, "Unknown")
-				return
-			} else {
-				log.INFO.Println("Received status from " + k)
-
-				if status == "Unhealthy" {
-					tmp.Health = "Unhealthy"
-					tmp.Timestamp = time.Now()
-					cache.Workers[k] = tmp
-
-					Respond(rw, true, "Unhealthy")
-					return
-				} else {
-					tmp.Health = "Healthy"
-					tmp.Timestamp = time.Now()
-					cache.Workers[k] = tmp
-				}
-			}
-		} else {
-			log.WARNING.Println("Unable to retrieve status of " + k)
+// A REST endpoint that handles the metrics request.  It will 
+// return a json serialized structure holding the metrics each 
+// worker answered with under Workers, the metrics.Registry of 
+// each worker under Registries, the connector.Stats of each 
+// worker's ports under Ports and the registries merged into 
+// the node wide view under Node.  Every worker is asked at 
+// once, the metrics of a worker that does not answer are 
+// Unknown while its registry and ports are still collected.
+func (l *Lead) Metrics(rw http.ResponseWriter, r *http.Request) {
+	values := make(map[string]interface{})
+	registries := make(map[string]metrics.Snapshot)
+	ports := make(map[string]map[string]connector.Stats)
 
-			tmp.Health = "Unknown"
-			tmp.Timestamp = time.Now()
-			tmp.State = "Unknown"
-			cache.Workers[k] = tmp
+	for k, a := range l.askAll(r.Context(), control.Metrics) {
+		values[k] = l.metrics(a)
+	}
 
-			Respond(rw, false, "Unknown")
-			return
-		}
+	snapshots := make([]metrics.Snapshot, 0, len(values))
+	for k := range values {
+		registries[k] = l.registry(k)
+		ports[k] = l.portStats(k)
+		snapshots = append(snapshots, registries[k])
 	}
 
-	Respond(rw, true, "Healthy")
+	node, err := metrics.Merge(snapshots...)
+	if err != nil {
+		log.WARNING.Println("Unable to merge the metrics of every worker: " + err.Error())
+	}
+
+	Respond(rw, true, map[string]interface{}{
+		"Workers": values,
+		"Registries": registries,
+		"Ports": ports,
+		"Node": node,
+	})
 	return
 }
 
-// A REST endpoint that handles the metrics request.  It will 
-// return a json serialized structure of a map containing an 
-// interface.  All the metrics are specified by each worker 
-// separately.
-func (l *Lead) Metrics(rw http.ResponseWriter, r *http.Request) {
-	metrics := make(map[string]interface{})
-
-	for k, v := range l.Ports {
-		if writeChannel(v.Channel(), "METRICS") {
-			if metrics[k] = readChannel(v.Channel()); metrics[k] != nil {
-				tmp := cache.Workers[k]
-				tmp.Metric = metrics[k]
-				tmp.Timestamp = time.Now()
-				cache.Workers[k] = tmp
-
-				log.INFO.Println("Received metrics from " + k)
-			} else {
-				metrics[k] = "Unknown"
-				log.WARNING.Println("Unable to retrieve metrics of " + k)
+// A REST endpoint that manages a single worker without 
+// touching the rest of the node.  The path is of the form 
+// /workers/{name}/{action} where the action is one of start, 
+// stop, restart, status or metrics.  Like /start and /stop 
+// the start, stop and restart actions must be POSTs and need 
+// to be authorized.
+func (l *Lead) Worker(rw http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/workers/"), "/"), "/")
+	if len(parts) != 2 {
+		Respond(rw, false, "Usage: /workers/{name}/{start|stop|restart|status|metrics}")
+		return
+	}
+
+	name, action := parts[0], parts[1]
+
+	w := l.worker(name)
+	if w == nil || l.Ports[name] == nil {
+		Respond(rw, false, "Unknown worker " + name + ".")
+		return
+	}
+
+	switch action {
+	case "start":
+		if !l.post(rw, r) || !l.authorize(rw, r) {
+			return
+		}
+
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		if c, _ := l.cache.Get(name); c.State == "Running" {
+			Respond(rw, false, "Worker " + name + " already started.")
+			return
+		}
+
+		l.startRoutes()
+
+		if !l.rerun(w) {
+			Respond(rw, false, "Worker " + name + " failed to start.")
+			return
+		}
+
+		Respond(rw, true, "Worker " + name + " started :-)")
+	case "stop", "restart":
+		if !l.post(rw, r) || !l.authorize(rw, r) {
+			return
+		}
+
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		if c, _ := l.cache.Get(name); c.State == "Stopped" {
+			if action == "stop" {
+				Respond(rw, false, "Worker " + name + " already stopped.")
+				return
+			}
+		} else if len(l.halt([]string{name})) > 0 {
+			if !l.stopped(l.askEach(r.Context(), control.Stop, []string{name})[name]) {
+				Respond(rw, false, "Unable to stop worker " + name + ".")
+				return
 			}
-		} else {
-			metrics[k] = "Unknown"
-			log.WARNING.Println("Unable to retrieve metrics of " + k)
 		}
+
+		if action == "stop" {
+			Respond(rw, true, "Worker " + name + " stopped :-(")
+			return
+		}
+
+		l.startRoutes()
+
+		if !l.rerun(w) {
+			Respond(rw, false, "Worker " + name + " failed to restart.")
+			return
+		}
+
+		Respond(rw, true, "Worker " + name + " restarted :-)")
+	case "status":
+		status := l.status(l.askEach(r.Context(), control.Status, []string{name})[name])
+		Respond(rw, status.Health != "Unknown", status)
+	case "metrics":
+		Respond(rw, true, map[string]interface{}{
+			"Metric": l.metrics(l.askEach(r.Context(), control.Metrics, []string{name})[name]),
+			"Registry": l.registry(name),
+			"Ports": l.portStats(name),
+		})
+	default:
+		Respond(rw, false, "Unknown action " + action + ".")
 	}
 
-	Respond(rw, true, metrics)
 	return
 }
 
 // A REST endpoint that will return the current cache that the 
 // leader has.  This is useful to see if anything wrong is 
-// happening in the distribution.
+// happening in the distribution.  The metrics.Registry and 
+// the stats of every port are collected first so they are 
+// current.
 func (l *Lead) Cache(rw http.ResponseWriter, r *http.Request) {
-	Respond(rw, true, cache)
+	for _, w := range l.Workers {
+		l.registry(w.Name())
+		l.portStats(w.Name())
+	}
+
+	Respond(rw, true, l.cache.Snapshot())
 	return
 }
 
@@ -275,47 +605,422 @@ func (l *Lead) Config(rw http.ResponseWriter, r *http.Request) {
 	return
 }
 
-// The last function a leader will call.  Currently just 
-// uses os.Exit to quit.
+// Opens every port of the worker then runs it in its own go 
+// routine under a supervisor.  A worker whose ports failed to 
+// open is not run and its state is set to Failed.
+func (l *Lead) startWorker(w worker.Worker) bool {
+	var opened []connector.Connector
+
+	for name, p := range w.Ports() {
+		if err := p.Open(context.Background()); err != nil {
+			log.ERROR.Println("Worker: " + w.Name() + " port " + name + " failed to open: " + err.Error())
+			l.events.publish(EventConnector, w.Name(), map[string]string{"Port": name, "Error": err.Error()})
+
+			for _, o := range opened {
+				o.Close()
+			}
+
+			l.cache.Update(w.Name(), func(c *WorkerCache) {
+				c.State = "Failed"
+			})
+			return false
+		}
+
+		opened = append(opened, p)
+	}
+
+	l.cache.Update(w.Name(), func(c *WorkerCache) {
+		c.State = "Running"
+	})
+
+	if l.supervisors == nil {
+		l.supervisors = make(map[string]*supervisor)
+	}
+	l.supervisors[w.Name()] = l.supervise(w)
+
+	return true
+}
+
+// Initializes the worker again and starts it once its last 
+// Run, if any, has returned so the worker never runs twice at 
+// once.  Returns false when the last Run did not return within 
+// the returnTimeout or the worker failed to start.
+func (l *Lead) rerun(w worker.Worker) bool {
+	// A worker waiting to be restarted is not running, its 
+	// supervisor is told to give up on it.
+	if c, _ := l.cache.Get(w.Name()); c.State == "Restarting" {
+		l.halt([]string{w.Name()})
+	}
+
+	if s := l.supervisors[w.Name()]; s != nil {
+		select {
+		case <-s.done:
+		case <-time.After(returnTimeout):
+			log.ERROR.Println("Worker: " + w.Name() + " is still running, it is not started again.")
+			return false
+		}
+	}
+
+	w.Init()
+	return l.startWorker(w)
+}
+
+// Tells the supervisors of the named workers that they are 
+// being stopped.  Returns the workers that are running and 
+// need to be asked to stop, the others are recorded as Stopped.
+func (l *Lead) halt(names []string) []string {
+	var running []string
+
+	for _, k := range names {
+		if s := l.supervisors[k]; s == nil {
+			l.cache.Update(k, func(w *WorkerCache) {
+				w.State = "Stopped"
+			})
+		} else if s.stop() {
+			running = append(running, k)
+		}
+	}
+
+	return running
+}
+
+// Records the answer of a worker to a stop request, closing 
+// its ports when it stopped.  Returns whether it stopped.
+func (l *Lead) stopped(a answer) bool {
+	state := "Stopped"
+	if a.err == nil {
+		l.closePorts(a.name)
+	} else {
+		log.WARNING.Println("Unable to stop worker " + a.name + ": " + a.err.Error())
+		state = "Unknown"
+	}
+
+	l.cache.Update(a.name, func(w *WorkerCache) {
+		w.State = state
+	})
+
+	return a.err == nil
+}
+
+// Records the answer of a worker to a status request and 
+// returns its status.
+func (l *Lead) status(a answer) WorkerStatus {
+	status := WorkerStatus{
+		Health: "Healthy",
+		LatencyMs: float64(a.latency) / float64(time.Millisecond),
+	}
+
+	if a.err != nil {
+		log.WARNING.Println("Unable to retrieve status of " + a.name + ": " + a.err.Error())
+
+		status.Health = "Unknown"
+		status.Reason = a.err.Error()
+	} else {
+		log.INFO.Println("Received status from " + a.name)
+
+		if a.response.Value == control.Unhealthy {
+			status.Health = "Unhealthy"
+			status.Reason = "Worker reported it is unhealthy"
+		}
+	}
+
+	l.cache.Update(a.name, func(w *WorkerCache) {
+		w.Health = status.Health
+		if status.Health == "Unknown" {
+			w.State = "Unknown"
+		}
+	})
+
+	return status
+}
+
+// Records the answer of a worker to a metrics request and 
+// returns its metrics, or Unknown when it did not answer.
+func (l *Lead) metrics(a answer) interface{} {
+	if a.err != nil {
+		log.WARNING.Println("Unable to retrieve metrics of " + a.name + ": " + a.err.Error())
+		return "Unknown"
+	}
+
+	l.cache.Update(a.name, func(w *WorkerCache) {
+		w.Metric = a.response.Value
+	})
+
+	log.INFO.Println("Received metrics from " + a.name)
+	return a.response.Value
+}
+
+// Collects the named worker's metrics.Registry into the cache 
+// and returns it.
+func (l *Lead) registry(name string) metrics.Snapshot {
+	s := metrics.NewRegistry().Snapshot()
+	if i, ok := l.worker(name).(worker.Instrumented); ok {
+		s = i.Metrics().Snapshot()
+	}
+
+	l.cache.Update(name, func(w *WorkerCache) {
+		w.Registry = s
+	})
+
+	return s
+}
+
+// Collects the connector.Stats of each of the named worker's 
+// ports into the cache and returns them.
+func (l *Lead) portStats(name string) map[string]connector.Stats {
+	stats := make(map[string]connector.Stats)
+
+	if w := l.worker(name); w != nil {
+		for k, p := range w.Ports() {
+			stats[k] = connector.StatsOf(p)
+		}
+	}
+
+	l.cache.Update(name, func(w *WorkerCache) {
+		w.Ports = stats
+	})
+
+	return stats
+}
+
+// Returns the named worker or nil when there is none.
+func (l *Lead) worker(name string) worker.Worker {
+	for _, w := range l.Workers {
+		if w.Name() == name {
+			return w
+		}
+	}
+
+	return nil
+}
+
+// Closes every port of the named worker once it has been 
+// told to stop.
+func (l *Lead) closePorts(name string) {
+	for _, w := range l.Workers {
+		if w.Name() != name {
+			continue
+		}
+
+		for port, p := range w.Ports() {
+			if err := p.Close(); err != nil && err != connector.ErrNotOpen {
+				log.WARNING.Println("Worker: " + name + " port " + port + " failed to close: " + err.Error())
+			}
+		}
+	}
+}
+
+// Builds every route of the leader that is not already 
+// running.  Routes that fail to build are logged and skipped.
+func (l *Lead) startRoutes() {
+	if len(l.routes) > 0 {
+		return
+	}
+
+	for _, r := range l.Routes {
+		h, err := r(context.Background())
+		if err != nil {
+			log.ERROR.Println("Leader: " + l.Name_ + " failed to build a route: " + err.Error())
+			continue
+		}
+
+		l.routes = append(l.routes, h)
+	}
+}
+
+// Stops every route of the leader and waits for them to 
+// finish so they can be built again by startRoutes.
+func (l *Lead) stopRoutes() {
+	for _, h := range l.routes {
+		h.Stop()
+	}
+
+	for _, h := range l.routes {
+		h.Wait()
+	}
+
+	l.routes = nil
+}
+
+// The last function a leader will call.  It drains the 
+// leader, only the first time it is called, and shuts its 
+// REST server down gracefully.
 func (l *Lead) Exit() {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	l.drainOnce.Do(func() {
+		l.drain(ctx)
+		close(l.exited())
+	})
+
+	l.mu.Lock()
+	server := l.server
+	l.mu.Unlock()
+
+	// The event streams never go idle, end them so the 
+	// REST server can shut down.
+	l.exitClose.Do(func() { close(l.exiting()) })
+	l.events.close()
+
+	if server != nil {
+		if err := server.Shutdown(ctx); err != nil {
+			log.WARNING.Println("Leader: " + l.Name_ + " REST server did not shut down: " + err.Error())
+		}
+	}
+
 	log.INFO.Println("Leader: " + l.Name_ + " is stopped.")
-	os.Exit(0)
 }
 
-// Private function used to detect is all the workers are 
-// currently stopped or not.  This is used by the leader.Stop 
-// function to tell if the workers need to be stopped or 
-// the leader needs to exit.
-func allWorkersStopped() bool {
-	for _, v := range cache.Workers {
-		if v.State == "Stopped" {
-			return true
+// Closed once the leader was asked to exit.
+func (l *Lead) exiting() chan struct{} {
+	l.exitOnce.Do(func() {
+		l.exit = make(chan struct{})
+	})
+
+	return l.exit
+}
+
+// Closed once Exit drained the leader.
+func (l *Lead) exited() chan struct{} {
+	l.doneOnce.Do(func() {
+		l.done = make(chan struct{})
+	})
+
+	return l.done
+}
+
+// Stops the leader without losing data.  The ports bringing 
+// data in from other leaders are closed first, then the data 
+// already in the ports is given the drainTimeout to be 
+// processed before the workers are stopped, which closes 
+// the rest of their ports, and the routes are torn down.  
+// The leader's lock is only held once the data is drained.
+func (l *Lead) drain(ctx context.Context) {
+	log.INFO.Println("Leader: " + l.Name_ + " is draining...")
+
+	for _, w := range l.Workers {
+		for port, p := range w.Ports() {
+			if !source(p) {
+				continue
+			}
+
+			if err := p.Close(); err != nil && err != connector.ErrNotOpen {
+				log.WARNING.Println("Worker: " + w.Name() + " port " + port + " failed to close: " + err.Error())
+			}
 		}
 	}
 
-	return false
+	if !l.waitDrained(ctx) {
+		log.WARNING.Println("Leader: " + l.Name_ + " did not drain in time, buffered data is lost.")
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if names := l.cache.without("Stopped"); len(names) > 0 {
+		for _, a := range l.askEach(ctx, control.Stop, l.halt(names)) {
+			l.stopped(a)
+		}
+	}
+
+	l.stopRoutes()
 }
 
-// Will write to channel but timeout if channel 
-// is unavailable.
-func writeChannel(ch chan<- interface{}, data interface{}) bool {
-	select {
-	case <- time.After(time.Second * 2):
-		return false
-	case ch <- data:
+// Waits for the ports to be drained, returns false when the 
+// drainTimeout or the context ran out first.
+func (l *Lead) waitDrained(ctx context.Context) bool {
+	deadline := time.After(drainTimeout)
+
+	for !l.drained() {
+		select {
+		case <-deadline:
+			return false
+		case <-ctx.Done():
+			return false
+		case <-time.After(time.Millisecond * 10):
+		}
+	}
+
+	return true
+}
+
+// Returns true once no port of any worker has data waiting 
+// in its channel.
+func (l *Lead) drained() bool {
+	for _, w := range l.Workers {
+		for _, p := range w.Ports() {
+			if len(p.Channel()) > 0 {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// Returns the worse of the two healths, Unknown being worse 
+// than Unhealthy.
+func worse(a, b string) string {
+	if a == "Unknown" || b == "Unknown" {
+		return "Unknown"
+	}
+
+	if a == "Unhealthy" || b == "Unhealthy" {
+		return "Unhealthy"
+	}
+
+	return a
+}
+
+// Returns true if the connector brings data into the node 
+// from another leader.
+func source(c connector.Connector) bool {
+	switch c.(type) {
+	case *connector.ExternalUDPIngress, *connector.ExternalTCPIngress, *connector.ExternalUnixIngress:
 		return true
 	}
 
 	return false
 }
 
-// Will read from channel but will timeout if channel 
-// is unavailable.
-func readChannel(ch <-chan interface{}) interface{} {
-	select {
-	case <- time.After(time.Second * 2):
-		return nil
-	case data := <- ch:
-		return data
+// Sends a control request to every worker's management port 
+// at once and collects their answers.
+func (l *Lead) askAll(ctx context.Context, kind control.Kind) map[string]answer {
+	names := make([]string, 0, len(l.Ports))
+	for k, _ := range l.Ports {
+		names = append(names, k)
 	}
+
+	return l.askEach(ctx, kind, names)
+}
+
+// Sends a control request to the management port of each of 
+// the named workers at once and collects their answers.  All 
+// the answers are in once the controlTimeout or the context 
+// runs out.
+func (l *Lead) askEach(ctx context.Context, kind control.Kind, names []string) map[string]answer {
+	// Timed from before the timeout starts so a worker that 
+	// does not answer never shows less than controlTimeout.
+	start := time.Now()
+
+	ctx, cancel := context.WithTimeout(ctx, controlTimeout)
+	defer cancel()
+
+	answers := make(chan answer, len(names))
+
+	for _, k := range names {
+		go func(name string, port connector.Connector) {
+			res, err := control.Ask(ctx, port, kind)
+			answers <- answer{name, res, err, time.Since(start)}
+		}(k, l.Ports[k])
+	}
+
+	all := make(map[string]answer, len(names))
+	for range names {
+		a := <-answers
+		all[a.name] = a
+	}
+
+	return all
 }
@@ -5,41 +5,1688 @@ package leader
 */
 
 import (
+	"github.com/go-emd/emd/config"
+	"github.com/go-emd/emd/connector"
+	"github.com/go-emd/emd/connector/load"
+	"github.com/go-emd/emd/control"
+	"github.com/go-emd/emd/core"
+	"github.com/go-emd/emd/log"
+	"github.com/go-emd/emd/metrics"
+	"github.com/go-emd/emd/worker"
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
-func TestInit(t *testing.T) {
-	
+// Stops the workers and routes of the leader once the test 
+// ends, even when it fails, and waits for the Run of every 
+// worker the leader started to return.
+func stopLead(t *testing.T, l *Lead) {
+	t.Cleanup(func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		for _, a := range l.askEach(context.Background(), control.Stop, l.halt(l.cache.without("Stopped"))) {
+			l.stopped(a)
+		}
+		l.stopRoutes()
+
+		for name, s := range l.supervisors {
+			select {
+			case <-s.done:
+			case <-time.After(returnTimeout):
+				t.Error("worker", name, "is still running")
+			}
+		}
+	})
 }
 
-func TestRun(t *testing.T) {
-	
+// A connector that never opens.
+type brokenConnector struct {
+	connector.Base
 }
 
-func TestExit(t *testing.T) {
-	
+func (b *brokenConnector) Open(ctx context.Context) error {
+	return errors.New("broken")
+}
+
+func (b *brokenConnector) Close() error {
+	return nil
+}
+
+func (b *brokenConnector) Channel() chan interface{} {
+	return b.Channel_
+}
+
+// A worker that reports when it was run.
+type testWorker struct {
+	worker.Work
+	ran chan bool
+}
+
+func (w *testWorker) Init() {}
+
+func (w *testWorker) Run() {
+	w.ran <- true
+}
+
+// Returns a leader with a good worker that runs once and a 
+// bad worker whose port never opens.
+func startLead() (*Lead, *testWorker, *testWorker) {
+	mgmt := &connector.Local{Base: connector.Base{Core: core.Core{Name_: "MGMT"}, Channel_: make(chan interface{})}}
+
+	good := &testWorker{
+		worker.Work{Core: core.Core{Name_: "Good"}, Ports_: map[string]connector.Connector{"MGMT_Good": mgmt}},
+		make(chan bool, 1),
+	}
+
+	bad := &testWorker{
+		worker.Work{Core: core.Core{Name_: "Bad"}, Ports_: map[string]connector.Connector{
+			"MGMT_Bad": mgmt,
+			"Broken": &brokenConnector{connector.Base{Core: core.Core{Name_: "Broken"}}},
+		}},
+		make(chan bool, 1),
+	}
+
+	l := &Lead{
+		Workers: []worker.Worker{good, bad},
+		Ports: map[string]connector.Connector{"Good": mgmt, "Bad": mgmt},
+	}
+	l.Init()
+
+	return l, good, bad
+}
+
+func TestInit(t *testing.T) {
+	log.Init(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
+
+	l, _, _ := startLead()
+
+	// Every worker starts out initialized.
+	for _, name := range []string{"Good", "Bad"} {
+		if c, ok := l.cache.Get(name); !ok || c.State != "Initialized" {
+			t.Error("unexpected cache", name, c)
+		}
+	}
+
+	if len(l.supervisors) != 0 {
+		t.Error("workers started on Init", l.supervisors)
+	}
 }
 
 func TestStart(t *testing.T) {
-	
+	log.Init(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
+
+	l, good, _ := startLead()
+	defer func() { <-l.supervisors["Good"].done }()
+
+	// The failed workers are named in the answer.
+	rw := httptest.NewRecorder()
+	l.Start(rw, httptest.NewRequest("POST", "/start", nil))
+
+	var resp struct {
+		Success bool
+		Message string
+	}
+	json.Unmarshal(rw.Body.Bytes(), &resp)
+
+	if resp.Success || !strings.Contains(resp.Message, "Bad") || strings.Contains(resp.Message, "Good") {
+		t.Error("unexpected answer", rw.Body.String())
+	}
+
+	if !<-good.ran {
+		t.Error("good worker did not run")
+	}
+}
+
+func TestStartWorker(t *testing.T) {
+	log.Init(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
+
+	l, good, bad := startLead()
+	defer func() { <-l.supervisors["Good"].done }()
+
+	if !l.startWorker(good) || !<-good.ran {
+		t.Error("good worker did not run")
+	}
+
+	if l.startWorker(bad) {
+		t.Error("bad worker should not start")
+	}
+
+	states := l.cache.Snapshot().Workers
+	if states["Bad"].State != "Failed" || states["Good"].State == "Failed" {
+		t.Error("unexpected states", states)
+	}
+
+	select {
+	case <-bad.ran:
+		t.Error("bad worker ran")
+	default:
+	}
 }
 
 func TestStop(t *testing.T) {
-	
+	log.Init(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
+
+	l, good, _ := startLead()
+	if !l.startWorker(good) || !<-good.ran {
+		t.Fatal("good worker did not run")
+	}
+
+	stop := func(method string) *httptest.ResponseRecorder {
+		rw := httptest.NewRecorder()
+		l.Stop(rw, httptest.NewRequest(method, "/stop", nil))
+		return rw
+	}
+
+	// Only a POST stops the leader.
+	if rw := stop("GET"); rw.Code != http.StatusMethodNotAllowed {
+		t.Error("unexpected answer", rw.Code, rw.Body.String())
+	}
+
+	// The first stop stops the workers.
+	if rw := stop("POST"); !strings.Contains(rw.Body.String(), "Workers stopped") {
+		t.Error("unexpected answer", rw.Body.String())
+	}
+	<-l.supervisors["Good"].done
+
+	if c, _ := l.cache.Get("Good"); c.State != "Stopped" {
+		t.Error("worker was not stopped", c)
+	}
+
+	// The second one asks Run to exit and answers once 
+	// the leader drained.
+	exited := make(chan bool)
+	go func() {
+		<-l.exiting()
+		l.Exit()
+		exited <- true
+	}()
+
+	if rw := stop("POST"); !strings.Contains(rw.Body.String(), "Leader stopped") {
+		t.Error("unexpected answer", rw.Body.String())
+	}
+
+	select {
+	case <-l.exited():
+	default:
+		t.Error("answered before the leader drained")
+	}
+	<-exited
 }
 
 func TestStatus(t *testing.T) {
-	
+	log.Init(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
+
+	defer func(d time.Duration) { controlTimeout = d }(controlTimeout)
+	controlTimeout = time.Millisecond * 100
+
+	l := &Lead{Core: core.Core{Name_: "Test"}, Ports: make(map[string]connector.Connector)}
+
+	for _, name := range []string{"Healthy", "Unhealthy", "Wedged1", "Wedged2"} {
+		mgmt := control.NewPort("MGMT_" + name)
+		l.Ports[name] = mgmt
+
+		w := &controlWorker{
+			worker.Work{Core: core.Core{Name_: name}, Ports_: map[string]connector.Connector{"MGMT_" + name: mgmt}},
+			name,
+		}
+		l.Workers = append(l.Workers, w)
+
+	}
+	l.Init()
+
+	// Wedged workers never read their requests.
+	for _, w := range l.Workers {
+		if !strings.HasPrefix(w.Name(), "Wedged") {
+			go w.Run()
+			t.Cleanup(func() { control.Ask(context.Background(), l.Ports[w.Name()], control.Stop) })
+		}
+	}
+
+	start := time.Now()
+	rw := httptest.NewRecorder()
+	l.Status(rw, httptest.NewRequest("GET", "/status", nil))
+
+	// The wedged workers are waited on at the same time.
+	if time.Since(start) > controlTimeout*2 {
+		t.Error("status took", time.Since(start))
+	}
+
+	var res struct {
+		Success bool
+		Message struct {
+			Health  string
+			Workers map[string]WorkerStatus
+		}
+	}
+	if err := json.Unmarshal(rw.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+
+	workers := res.Message.Workers
+	if res.Success || res.Message.Health != "Unknown" || len(workers) != 4 {
+		t.Error("unexpected status", rw.Body.String())
+	}
+
+	if workers["Healthy"].Health != "Healthy" || workers["Unhealthy"].Health != "Unhealthy" || workers["Unhealthy"].Reason == "" {
+		t.Error("unexpected status", rw.Body.String())
+	}
+
+	if workers["Wedged1"].Health != "Unknown" || workers["Wedged2"].Reason != context.DeadlineExceeded.Error() {
+		t.Error("unexpected status", rw.Body.String())
+	}
+
+	if workers["Wedged1"].LatencyMs < 100 {
+		t.Error("unexpected latency", workers["Wedged1"].LatencyMs)
+	}
 }
 
 func TestMetrics(t *testing.T) {
-	
+	log.Init(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
+
+	defer func(d time.Duration) { controlTimeout = d }(controlTimeout)
+	controlTimeout = time.Millisecond * 100
+
+	l := &Lead{Core: core.Core{Name_: "Test"}, Ports: make(map[string]connector.Connector)}
+
+	for _, name := range []string{"Counting", "Wedged"} {
+		mgmt := control.NewPort("MGMT_" + name)
+		l.Ports[name] = mgmt
+
+		w := &controlWorker{
+			worker.Work{Core: core.Core{Name_: name}, Ports_: map[string]connector.Connector{"MGMT_" + name: mgmt}},
+			"Healthy",
+		}
+		l.Workers = append(l.Workers, w)
+
+		w.Metrics().Counter("Processed").Add(2)
+		w.Metrics().Histogram("Latency").Observe(0.5)
+
+		// The wedged worker never reads its requests.
+		if name != "Wedged" {
+			go w.Run()
+			t.Cleanup(func() { control.Ask(context.Background(), mgmt, control.Stop) })
+		}
+	}
+	l.Init()
+
+	rw := httptest.NewRecorder()
+	l.Metrics(rw, httptest.NewRequest("GET", "/metrics", nil))
+
+	var res struct {
+		Success bool
+		Message struct {
+			Workers    map[string]interface{}
+			Registries map[string]metrics.Snapshot
+			Ports      map[string]map[string]connector.Stats
+			Node       metrics.Snapshot
+		}
+	}
+	if err := json.Unmarshal(rw.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+
+	m := res.Message
+	if !res.Success || m.Workers["Wedged"] != "Unknown" || m.Workers["Counting"] == "Unknown" {
+		t.Error("unexpected metrics", rw.Body.String())
+	}
+
+	// The registry of a worker is collected even when it does 
+	// not answer.
+	if m.Registries["Wedged"].Counters["Processed"] != 2 || m.Node.Counters["Processed"] != 4 {
+		t.Error("unexpected registries", rw.Body.String())
+	}
+
+	if h := m.Node.Histograms["Latency"]; h.Count != 2 || h.Sum != 1 {
+		t.Error("unexpected node histogram", h)
+	}
+
+	if c, _ := l.cache.Get("Wedged"); c.Registry.Counters["Processed"] != 2 {
+		t.Error("registry was not cached", c)
+	}
+
+	if s, ok := m.Ports["Wedged"]["MGMT_Wedged"]; !ok || s.Capacity != 0 || len(m.Ports["Counting"]) != 1 {
+		t.Error("unexpected ports", rw.Body.String())
+	}
+
+	rw = httptest.NewRecorder()
+	l.Cache(rw, httptest.NewRequest("GET", "/cache", nil))
+	if !strings.Contains(rw.Body.String(), `"MGMT_Counting":{"Sent":0`) {
+		t.Error("ports are not in the cache", rw.Body.String())
+	}
+
+	// Leaders with workers of the same name do not share 
+	// their metrics.
+	other := &controlWorker{worker.Work{Core: core.Core{Name_: "Counting"}}, "Healthy"}
+	o := &Lead{Core: core.Core{Name_: "Other"}, Workers: []worker.Worker{other}, Ports: map[string]connector.Connector{"Counting": control.NewPort("MGMT_Counting")}}
+	o.Init()
+
+	if s := o.registry("Counting"); len(s.Counters) != 0 || l.registry("Counting").Counters["Processed"] != 2 {
+		t.Error("registries are shared", s)
+	}
 }
 
 func TestCache(t *testing.T) {
-	
+	log.Init(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
+
+	a := &Lead{Ports: map[string]connector.Connector{"A": control.NewPort("MGMT_A")}}
+	b := &Lead{Ports: map[string]connector.Connector{"B": control.NewPort("MGMT_B")}}
+	a.Init()
+	b.Init()
+
+	// Each leader has its own cache.
+	if _, ok := a.cache.Get("B"); ok {
+		t.Error("leaders share their cache")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			a.cache.Update("A", func(w *WorkerCache) { w.Health = "Healthy" })
+		}()
+		go func() {
+			defer wg.Done()
+			a.Cache(httptest.NewRecorder(), nil)
+		}()
+	}
+	wg.Wait()
+
+	rw := httptest.NewRecorder()
+	a.Cache(rw, nil)
+
+	var res struct {
+		Success bool
+		Message struct {
+			Workers map[string]WorkerCache
+		}
+	}
+	if err := json.Unmarshal(rw.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+
+	if !res.Success || res.Message.Workers["A"].Health != "Healthy" || len(res.Message.Workers) != 1 {
+		t.Error("unexpected cache", rw.Body.String())
+	}
 }
 
 func TestConfig(t *testing.T) {
-	
+	log.Init(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	err := ioutil.WriteFile(path, []byte(`{
+		"GUI_port": "1234",
+		"History": {"Samples": 5},
+		"Nodes": [{
+			"Hostname": "example.com",
+			"Workers": [
+				{"Name": "A", "Restart": "OnFailure", "MaxRestarts": 3, "Backoff": "2s"},
+				{"Name": "Elsewhere", "Restart": "Always"}
+			]
+		}]
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := &controlWorker{worker.Work{Core: core.Core{Name_: "A"}, Ports_: nil}, "Healthy"}
+	l := &Lead{
+		Core: core.Core{Name_: "Test"},
+		ConfigPath: path,
+		Workers: []worker.Worker{w},
+		History: config.History{Interval: "1m"},
+	}
+	l.Init()
+
+	// Only the policies of the leader's workers are kept.
+	if len(l.Policies) != 1 || l.Policies["A"] != (Policy{config.RestartOnFailure, 3, time.Second * 2}) {
+		t.Error("unexpected policies", l.Policies)
+	}
+
+	// What the leader was given is kept.
+	if len(l.Nodes) != 1 || l.History.Interval != "1m" || l.History.Samples != 0 {
+		t.Error("unexpected config", l.Nodes, l.History)
+	}
+
+	rw := httptest.NewRecorder()
+	l.Config(rw, httptest.NewRequest("GET", "/config", nil))
+	if !strings.Contains(rw.Body.String(), `"Hostname":"example.com"`) {
+		t.Error("unexpected config", rw.Body.String())
+	}
+}
+
+func TestSplitLocal(t *testing.T) {
+	log.Init(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	err := ioutil.WriteFile(path, []byte(`{
+		"Nodes": [{
+			"Hostname": "localhost",
+			"Workers": [
+				{"Name": "A", "Connections": [{"Type": "LocalEgress", "Worker": "B", "Alias": "A_to_B"}]},
+				{"Name": "B", "Connections": [{"Type": "LocalIngress", "Worker": "A", "Alias": "A_to_B"}]}
+			]
+		}]
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	shared := &connector.Local{Base: connector.Base{Core: core.Core{Name_: "A_to_B"}, Channel_: make(chan interface{})}}
+	a := &controlWorker{worker.Work{Core: core.Core{Name_: "A"}, Ports_: map[string]connector.Connector{"A_to_B": shared}}, "Healthy"}
+	b := &controlWorker{worker.Work{Core: core.Core{Name_: "B"}, Ports_: map[string]connector.Connector{"A_to_B": shared}}, "Healthy"}
+	l := &Lead{
+		Core: core.Core{Name_: "Test"},
+		ConfigPath: path,
+		Workers: []worker.Worker{a, b},
+	}
+	l.Init()
+
+	// The sending worker keeps the shared Local, the 
+	// receiving one is given an ingress of its own.
+	in, ok := b.Ports()["A_to_B"].(*connector.Local)
+	if a.Ports()["A_to_B"] != connector.Connector(shared) || !ok || in == shared {
+		t.Fatal("unexpected ports", a.Ports(), b.Ports())
+	}
+
+	if err := in.Open(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+
+	shared.Channel() <- "value"
+	if v := <-in.Channel(); v != "value" {
+		t.Error("unexpected value", v)
+	}
+
+	if s := shared.Stats(); s.Sent != 1 {
+		t.Error("unexpected egress stats", s)
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	log.Init(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
+
+	in := []chan interface{}{make(chan interface{})}
+	out := []chan interface{}{make(chan interface{})}
+
+	built := 0
+	l := &Lead{Core: core.Core{Name_: "Test"}}
+	l.Routes = []Route{
+		func(ctx context.Context) (*load.Handle, error) {
+			built += 1
+			return load.NtoN(ctx, load.Copy, out, in)
+		},
+		func(ctx context.Context) (*load.Handle, error) {
+			return load.NtoN(ctx, load.Copy, nil, nil)
+		},
+	}
+
+	l.startRoutes()
+	if len(l.routes) != 1 {
+		t.Fatal("expected one route got", len(l.routes))
+	}
+
+	in[0] <- "TEST"
+	if <-out[0] != "TEST" {
+		t.Error("route did not forward")
+	}
+
+	h := l.routes[0]
+	l.stopRoutes()
+
+	select {
+	case <-h.Done():
+	default:
+		t.Error("route was not stopped")
+	}
+
+	// Routes are rebuilt the next time the workers start.
+	l.startRoutes()
+	l.startRoutes()
+	if built != 2 || len(l.routes) != 1 {
+		t.Error("route was not rebuilt once", built, len(l.routes))
+	}
+
+	in[0] <- "TEST"
+	if <-out[0] != "TEST" {
+		t.Error("rebuilt route did not forward")
+	}
+
+	l.stopRoutes()
+}
+
+// A worker serving control requests until it is stopped.
+type controlWorker struct {
+	worker.Work
+	health string
+}
+
+func (w *controlWorker) Init() {}
+
+func (w *controlWorker) Run() {
+	for req := range w.Control() {
+		status := func() interface{} { return w.health }
+		metrics := func() interface{} { return map[string]int{"Count": 1} }
+
+		if w.Serve(req, status, metrics) {
+			return
+		}
+	}
+}
+
+func TestControl(t *testing.T) {
+	log.Init(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
+
+	mgmt := control.NewPort("MGMT_Control")
+	w := &controlWorker{
+		worker.Work{Core: core.Core{Name_: "Control"}, Ports_: map[string]connector.Connector{"MGMT_Control": mgmt}},
+		"Unhealthy",
+	}
+
+	l := &Lead{
+		Core: core.Core{Name_: "Test"},
+		Workers: []worker.Worker{w},
+		Ports: map[string]connector.Connector{"Control": mgmt},
+	}
+	l.Init()
+	stopLead(t, l)
+	l.startWorker(w)
+
+	// Data sent to the worker does not interfere with control.
+	go func() { mgmt.Channel() <- "DATA" }()
+
+	rw := httptest.NewRecorder()
+	l.Status(rw, httptest.NewRequest("GET", "/status", nil))
+	if !strings.Contains(rw.Body.String(), "Unhealthy") || l.cache.Workers["Control"].Health != "Unhealthy" {
+		t.Error("unexpected status", rw.Body.String())
+	}
+
+	rw = httptest.NewRecorder()
+	l.Metrics(rw, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.Contains(rw.Body.String(), `"Count":1`) {
+		t.Error("unexpected metrics", rw.Body.String())
+	}
+
+	<-mgmt.Channel()
+}
+
+func TestPrometheus(t *testing.T) {
+	log.Init(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
+
+	mgmt := control.NewPort("MGMT_Prom")
+	w := &controlWorker{
+		worker.Work{Core: core.Core{Name_: "Prom"}, Ports_: map[string]connector.Connector{"MGMT_Prom": mgmt}},
+		"Healthy",
+	}
+
+	l := &Lead{
+		Core: core.Core{Name_: `Te"st`},
+		Workers: []worker.Worker{w},
+		Ports: map[string]connector.Connector{"Prom": mgmt},
+	}
+	l.Init()
+	stopLead(t, l)
+	l.startWorker(w)
+
+	w.Metrics().Counter("Processed").Add(3)
+	w.Metrics().Gauge("Backlog").Set(1.5)
+	w.Metrics().Histogram("Latency", 1).Observe(0.5)
+	w.Metrics().Histogram("Latency").Observe(2)
+
+	rw := httptest.NewRecorder()
+	l.Prometheus(rw, httptest.NewRequest("GET", "/metrics/prometheus", nil))
+
+	if !strings.HasPrefix(rw.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Error("unexpected content type", rw.Header().Get("Content-Type"))
+	}
+
+	body := rw.Body.String()
+	for _, line := range []string{
+		"# TYPE emd_worker_state gauge",
+		`emd_worker_state{node="Te\"st",worker="Prom",state="Running"} 1`,
+		`emd_worker_state{node="Te\"st",worker="Prom",state="Stopped"} 0`,
+		`emd_worker_health{node="Te\"st",worker="Prom",health="Unknown"} 1`,
+		`emd_worker_restarts_total{node="Te\"st",worker="Prom"} 0`,
+		`emd_port_channel_capacity{node="Te\"st",worker="Prom",port="MGMT_Prom"} 0`,
+		`emd_port_messages_received_total{node="Te\"st",worker="Prom",port="MGMT_Prom"} 0`,
+		`emd_worker_metric{node="Te\"st",worker="Prom",metric="Count"} 1`,
+		`emd_worker_counter_total{node="Te\"st",worker="Prom",name="Processed"} 3`,
+		`emd_worker_gauge{node="Te\"st",worker="Prom",name="Backlog"} 1.5`,
+		`emd_worker_histogram_bucket{node="Te\"st",worker="Prom",name="Latency",le="1"} 1`,
+		`emd_worker_histogram_bucket{node="Te\"st",worker="Prom",name="Latency",le="+Inf"} 2`,
+		`emd_worker_histogram_count{node="Te\"st",worker="Prom",name="Latency"} 2`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Error("missing", line, "in", body)
+		}
+	}
+
+	fields := numericFields(map[string]interface{}{"A": 1, "B": map[string]interface{}{"C": 2.5, "D": true}, "E": "text"})
+	if len(fields) != 3 || fields["A"] != 1 || fields["B.C"] != 2.5 || fields["B.D"] != 1 {
+		t.Error("unexpected fields", fields)
+	}
+
+	if fields := numericFields(7); fields["value"] != 7 {
+		t.Error("unexpected fields", fields)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	log.Init(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
+
+	defer func(n int) { eventHistory = n }(eventHistory)
+	eventHistory = 4
+
+	mgmt := control.NewPort("MGMT_Events")
+	w := &controlWorker{
+		worker.Work{Core: core.Core{Name_: "Events"}, Ports_: map[string]connector.Connector{"MGMT_Events": mgmt}},
+		"Healthy",
+	}
+
+	l := &Lead{
+		Core: core.Core{Name_: "Test"},
+		Workers: []worker.Worker{w},
+		Ports: map[string]connector.Connector{"Events": mgmt},
+	}
+	l.Init()
+	stopLead(t, l)
+
+	server := httptest.NewServer(http.HandlerFunc(l.Events))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Error("unexpected content type", resp.Header.Get("Content-Type"))
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	next := func() (id, kind string, ev Event) {
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			switch {
+			case strings.HasPrefix(line, "id: "):
+				id = strings.TrimSpace(line[4:])
+			case strings.HasPrefix(line, "event: "):
+				kind = strings.TrimSpace(line[7:])
+			case strings.HasPrefix(line, "data: "):
+				if err := json.Unmarshal([]byte(line[6:]), &ev); err != nil {
+					t.Fatal(err)
+				}
+			case line == "\n" && id != "":
+				return
+			}
+		}
+	}
+
+	l.startWorker(w)
+
+	id, kind, ev := next()
+	if id != "1" || kind != EventState || ev.Worker != "Events" || ev.Data.(map[string]interface{})["To"] != "Running" {
+		t.Error("unexpected event", id, kind, ev)
+	}
+
+	rw := httptest.NewRecorder()
+	l.Status(rw, httptest.NewRequest("GET", "/status", nil))
+
+	if _, kind, ev := next(); kind != EventHealth || ev.Data.(map[string]interface{})["To"] != "Healthy" {
+		t.Error("unexpected event", kind, ev)
+	}
+
+	l.publishMetrics(nil)
+	if _, kind, ev := next(); kind != EventMetrics || ev.Worker != "" {
+		t.Error("unexpected event", kind, ev)
+	}
+
+	// A client resuming gets the events after the last it saw.
+	req := httptest.NewRequest("GET", "/events", nil).WithContext(canceled())
+	req.Header.Set("Last-Event-ID", "1")
+	rw = httptest.NewRecorder()
+	l.Events(rw, req)
+
+	body := rw.Body.String()
+	if strings.Contains(body, "id: 1\n") || !strings.Contains(body, "id: 2\n") || !strings.Contains(body, "id: 3\n") {
+		t.Error("unexpected resumed events", body)
+	}
+
+	// Only the last eventHistory events are kept.
+	for i := 0; i < 4; i++ {
+		l.events.publish(EventMetrics, "", nil)
+	}
+
+	backlog, ch := l.events.subscribe(0)
+	l.events.unsubscribe(ch)
+	if len(backlog) != 4 || backlog[0].ID != 4 || backlog[3].ID != 7 {
+		t.Error("unexpected history", backlog)
+	}
+
+	// Exiting ends every stream.
+	l.events.close()
+	for {
+		if _, err := reader.ReadString('\n'); err != nil {
+			break
+		}
+	}
+}
+
+// Returns a context that is already done.
+func canceled() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	return ctx
+}
+
+func TestUI(t *testing.T) {
+	l := &Lead{Core: core.Core{Name_: "Test"}}
+
+	for path, content := range map[string]string{
+		"/ui/": "<title>emd leader</title>",
+		"/ui/app.js": `call("/cache")`,
+		"/ui/style.css": "#charts",
+	} {
+		rw := httptest.NewRecorder()
+		l.UI(rw, httptest.NewRequest("GET", path, nil))
+
+		if rw.Code != http.StatusOK || !strings.Contains(rw.Body.String(), content) {
+			t.Error("unexpected", path, rw.Code, rw.Body.String())
+		}
+
+		// Nothing is loaded from outside the leader.
+		for _, external := range []string{`src="http`, `href="http`, "url(http", "@import"} {
+			if strings.Contains(rw.Body.String(), external) {
+				t.Error(path, "loads an external asset")
+			}
+		}
+	}
+
+	rw := httptest.NewRecorder()
+	l.UI(rw, httptest.NewRequest("GET", "/ui/missing.js", nil))
+	if rw.Code != http.StatusNotFound {
+		t.Error("unexpected code", rw.Code)
+	}
+}
+
+func TestWorker(t *testing.T) {
+	log.Init(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
+
+	defer func(d time.Duration) { controlTimeout = d }(controlTimeout)
+	controlTimeout = time.Millisecond * 100
+
+	l := &Lead{Core: core.Core{Name_: "Test"}, Ports: make(map[string]connector.Connector)}
+
+	for _, name := range []string{"A", "B"} {
+		mgmt := control.NewPort("MGMT_" + name)
+		l.Ports[name] = mgmt
+		l.Workers = append(l.Workers, &controlWorker{
+			worker.Work{Core: core.Core{Name_: name}, Ports_: map[string]connector.Connector{"MGMT_" + name: mgmt}},
+			"Healthy",
+		})
+	}
+	l.Init()
+	stopLead(t, l)
+
+	for _, w := range l.Workers {
+		l.startWorker(w)
+	}
+
+	call := func(path string) (bool, string) {
+		rw := httptest.NewRecorder()
+		l.Worker(rw, httptest.NewRequest("POST", path, nil))
+
+		var res struct {
+			Success bool
+		}
+		json.Unmarshal(rw.Body.Bytes(), &res)
+		return res.Success, rw.Body.String()
+	}
+
+	if ok, body := call("/workers/A/stop"); !ok {
+		t.Error("stop failed", body)
+	}
+
+	// Only the stopped worker is affected.
+	states := l.cache.Snapshot().Workers
+	if states["A"].State != "Stopped" || states["B"].State != "Running" {
+		t.Error("unexpected states", states)
+	}
+
+	if ok, _ := call("/workers/A/stop"); ok {
+		t.Error("stopped worker stopped again")
+	}
+
+	if ok, _ := call("/workers/A/status"); ok {
+		t.Error("stopped worker answered")
+	}
+
+	if ok, body := call("/workers/B/status"); !ok || !strings.Contains(body, `"Healthy"`) {
+		t.Error("unexpected status", body)
+	}
+
+	if ok, body := call("/workers/A/start"); !ok {
+		t.Error("start failed", body)
+	}
+
+	if ok, _ := call("/workers/A/start"); ok {
+		t.Error("running worker started again")
+	}
+
+	if ok, body := call("/workers/A/restart"); !ok {
+		t.Error("restart failed", body)
+	}
+
+	if ok, body := call("/workers/A/metrics"); !ok || !strings.Contains(body, `"Count":1`) {
+		t.Error("unexpected metrics", body)
+	}
+
+	for _, path := range []string{"/workers/C/stop", "/workers/A/explode", "/workers/A"} {
+		if ok, _ := call(path); ok {
+			t.Error(path, "succeeded")
+		}
+	}
+}
+
+// A worker that panics every time it is run.
+type crashingWorker struct {
+	worker.Work
+	runs chan int
+	count int
+}
+
+func (w *crashingWorker) Init() {}
+
+func (w *crashingWorker) Run() {
+	w.count += 1
+	w.runs <- w.count
+	panic("crash " + strconv.Itoa(w.count))
+}
+
+func TestSupervisor(t *testing.T) {
+	log.Init(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
+
+	newLead := func(p Policy) (*Lead, *crashingWorker) {
+		w := &crashingWorker{worker.Work{Core: core.Core{Name_: "Crash"}, Ports_: nil}, make(chan int, 10), 0}
+		l := &Lead{
+			Workers: []worker.Worker{w},
+			Ports: map[string]connector.Connector{"Crash": control.NewPort("MGMT_Crash")},
+			Policies: map[string]Policy{"Crash": p},
+		}
+		l.Init()
+		stopLead(t, l)
+		l.startWorker(w)
+		return l, w
+	}
+
+	// Never restarted, but the panic does not take the leader down.
+	l, w := newLead(Policy{})
+	<-w.runs
+	<-l.supervisors["Crash"].done
+
+	if c, _ := l.cache.Get("Crash"); c.State != "Crashed" || c.Crashes != 1 || c.Restarts != 0 || c.Reason != "crash 1" {
+		t.Error("unexpected cache", c)
+	}
+
+	// Restarted on failure until the budget is spent.
+	l, w = newLead(Policy{Restart: config.RestartOnFailure, MaxRestarts: 2, Backoff: time.Millisecond})
+	<-l.supervisors["Crash"].done
+
+	if c, _ := l.cache.Get("Crash"); c.State != "Crashed" || c.Crashes != 3 || c.Restarts != 2 || c.Reason != "crash 3" {
+		t.Error("unexpected cache", c)
+	}
+
+	// Always restarted until the leader stops it while it 
+	// waits to be restarted.
+	l, w = newLead(Policy{Restart: config.RestartAlways, Backoff: time.Millisecond * 50})
+	<-w.runs
+
+	for {
+		if c, _ := l.cache.Get("Crash"); c.State == "Restarting" {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if running := l.halt([]string{"Crash"}); len(running) != 0 {
+		t.Error("crashed worker should not be asked to stop", running)
+	}
+	<-l.supervisors["Crash"].done
+
+	if c, _ := l.cache.Get("Crash"); c.State != "Stopped" || c.Crashes != 1 {
+		t.Error("unexpected cache", c)
+	}
+}
+
+// A connector that only tracks whether it is open.
+type trackedConnector struct {
+	connector.Base
+	open int32
+}
+
+func (c *trackedConnector) Open(ctx context.Context) error {
+	atomic.StoreInt32(&c.open, 1)
+	return nil
+}
+
+func (c *trackedConnector) Close() error {
+	atomic.StoreInt32(&c.open, 0)
+	return nil
+}
+
+func (c *trackedConnector) Channel() chan interface{} {
+	return c.Channel_
+}
+
+func TestSupervisorPorts(t *testing.T) {
+	log.Init(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
+
+	for _, p := range []Policy{{}, {Restart: config.RestartAlways, Backoff: time.Millisecond * 50}} {
+		port := &trackedConnector{}
+		w := &crashingWorker{worker.Work{Core: core.Core{Name_: "Crash"}, Ports_: map[string]connector.Connector{"Input": port}}, make(chan int, 10), 0}
+		l := &Lead{
+			Workers: []worker.Worker{w},
+			Ports: map[string]connector.Connector{"Crash": control.NewPort("MGMT_Crash")},
+			Policies: map[string]Policy{"Crash": p},
+		}
+		l.Init()
+
+		// The ports are closed by the time the worker is 
+		// seen as no longer running.
+		var open int32
+		notify := l.cache.notify
+		l.cache.notify = func(name string, before, after WorkerCache) {
+			if (after.State == "Crashed" || after.State == "Stopped") && atomic.LoadInt32(&port.open) == 1 {
+				atomic.StoreInt32(&open, 1)
+			}
+			notify(name, before, after)
+		}
+
+		l.startWorker(w)
+		<-w.runs
+
+		if p.Restart != "" {
+			for {
+				if c, _ := l.cache.Get("Crash"); c.State == "Restarting" {
+					break
+				}
+				time.Sleep(time.Millisecond)
+			}
+			l.halt([]string{"Crash"})
+		}
+		<-l.supervisors["Crash"].done
+
+		if atomic.LoadInt32(&open) != 0 || atomic.LoadInt32(&port.open) != 0 {
+			t.Error("ports still open once the worker stopped running", p)
+		}
+	}
+}
+
+func TestNewPolicy(t *testing.T) {
+	p := NewPolicy(config.WorkConfig{Name: "A", Restart: config.RestartOnFailure, MaxRestarts: 3, Backoff: "2s"})
+
+	if p != (Policy{config.RestartOnFailure, 3, time.Second * 2}) {
+		t.Error("unexpected policy", p)
+	}
+
+	if !p.restarts(true) || p.restarts(false) {
+		t.Error("OnFailure only restarts crashed workers")
+	}
+
+	if !(Policy{Restart: config.RestartAlways}).restarts(false) || (Policy{}).restarts(true) {
+		t.Error("unexpected restarts")
+	}
+}
+
+// A worker that slowly processes its input until it is stopped.
+type slowWorker struct {
+	worker.Work
+	processed chan interface{}
+}
+
+func (w *slowWorker) Init() {}
+
+func (w *slowWorker) Run() {
+	for {
+		select {
+		case req := <-w.Control():
+			if w.Serve(req, nil, nil) {
+				return
+			}
+		case data := <-w.Ports()["Input"].Channel():
+			time.Sleep(time.Millisecond * 5)
+			w.processed <- data
+		}
+	}
+}
+
+func TestExit(t *testing.T) {
+	log.Init(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
+
+	mgmt := control.NewPort("MGMT_Slow")
+	input := &connector.Local{Base: connector.Base{Core: core.Core{Name_: "Input"}, Channel_: make(chan interface{}, 10)}}
+
+	w := &slowWorker{
+		worker.Work{Core: core.Core{Name_: "Slow"}, Ports_: map[string]connector.Connector{"MGMT_Slow": mgmt, "Input": input}},
+		make(chan interface{}, 10),
+	}
+
+	l := &Lead{Core: core.Core{Name_: "Test"}, Workers: []worker.Worker{w}, Ports: map[string]connector.Connector{"Slow": mgmt}}
+	l.Init()
+	l.startWorker(w)
+
+	for i := 0; i < 5; i++ {
+		input.Channel() <- i
+	}
+
+	// The buffered data is processed before the worker is stopped.
+	l.Exit()
+
+	if len(w.processed) != 5 {
+		t.Error("expected 5 processed got", len(w.processed))
+	}
+
+	if c, _ := l.cache.Get("Slow"); c.State != "Stopped" {
+		t.Error("worker was not stopped", c)
+	}
+
+	// Only the first Exit drains the leader.
+	input.Channel() <- 5
+	l.Exit()
+
+	if len(input.Channel()) != 1 {
+		t.Error("the leader drained twice")
+	}
+
+	<-l.supervisors["Slow"].done
+}
+
+func TestRun(t *testing.T) {
+	log.Init(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
+
+	mgmt := control.NewPort("MGMT_Run")
+	w := &controlWorker{
+		worker.Work{Core: core.Core{Name_: "Run"}, Ports_: map[string]connector.Connector{"MGMT_Run": mgmt}},
+		"Healthy",
+	}
+
+	l := &Lead{Core: core.Core{Name_: "Test"}, GUI_port: "60010", Workers: []worker.Worker{w}, Ports: map[string]connector.Connector{"Run": mgmt}}
+	l.Init()
+
+	done := make(chan bool)
+	go func() {
+		l.Run()
+		done <- true
+	}()
+
+	stop := func() string {
+		for i := 0; ; i++ {
+			resp, err := http.Post("http://localhost:60010/stop", "", nil)
+			if err != nil {
+				if i == 100 {
+					t.Fatal(err)
+				}
+				time.Sleep(time.Millisecond * 10)
+				continue
+			}
+			defer resp.Body.Close()
+
+			b, _ := ioutil.ReadAll(resp.Body)
+			return string(b)
+		}
+	}
+
+	if body := stop(); !strings.Contains(body, "Workers stopped") {
+		t.Error("unexpected answer", body)
+	}
+
+	// The leader answers the second stop before it exits.
+	if body := stop(); !strings.Contains(body, "Leader stopped") {
+		t.Error("unexpected answer", body)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(time.Second * 5):
+		t.Fatal("Run did not return")
+	}
+
+	<-l.supervisors["Run"].done
+}
+
+func TestAuthorize(t *testing.T) {
+	log.Init(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
+
+	defer func(d time.Duration) { controlTimeout = d }(controlTimeout)
+	controlTimeout = time.Millisecond * 100
+
+	mgmt := control.NewPort("MGMT_A")
+	l := &Lead{
+		Core: core.Core{Name_: "Test"},
+		Ports: map[string]connector.Connector{"A": mgmt},
+		Security: config.Security{Tokens: []string{"first", "second"}},
+	}
+	l.Workers = append(l.Workers, &controlWorker{
+		worker.Work{Core: core.Core{Name_: "A"}, Ports_: map[string]connector.Connector{"MGMT_A": mgmt}},
+		"Healthy",
+	})
+	l.Init()
+	stopLead(t, l)
+	l.startWorker(l.Workers[0])
+
+	call := func(path, auth string, state *tls.ConnectionState) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, nil)
+		req.TLS = state
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+
+		rw := httptest.NewRecorder()
+		l.Worker(rw, req)
+		return rw
+	}
+
+	for _, auth := range []string{"", "Bearer", "Bearer third", "Basic first", "first"} {
+		rw := call("/workers/A/stop", auth, nil)
+		if rw.Code != http.StatusUnauthorized || rw.Header().Get("WWW-Authenticate") == "" {
+			t.Error(auth, "was authorized", rw.Code)
+		}
+	}
+
+	if c, _ := l.cache.Get("A"); c.State != "Running" {
+		t.Error("unauthorized stop stopped the worker")
+	}
+
+	// Reading is left open.
+	if rw := call("/workers/A/status", "", nil); rw.Code != http.StatusOK {
+		t.Error("status was refused", rw.Code)
+	}
+
+	if rw := call("/workers/A/stop", "Bearer second", nil); rw.Code != http.StatusOK {
+		t.Error("stop was refused", rw.Code, rw.Body.String())
+	}
+
+	// A verified client certificate only counts with a ClientCA.
+	verified := &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{&x509.Certificate{}}}}
+
+	if rw := call("/workers/A/start", "", verified); rw.Code != http.StatusUnauthorized {
+		t.Error("certificate accepted without a ClientCA", rw.Code)
+	}
+
+	l.Security.ClientCA = "ca.pem"
+	if rw := call("/workers/A/start", "", verified); rw.Code != http.StatusOK {
+		t.Error("start was refused", rw.Code, rw.Body.String())
+	}
+
+	if rw := call("/workers/A/stop", "", &tls.ConnectionState{}); rw.Code != http.StatusUnauthorized {
+		t.Error("unverified connection was authorized", rw.Code)
+	}
+
+	// A browser holding the certificate may only change the 
+	// distribution with a POST from the leader's own pages.
+	req := httptest.NewRequest("GET", "/workers/A/stop", nil)
+	req.TLS = verified
+	rw := httptest.NewRecorder()
+	l.Worker(rw, req)
+	if rw.Code != http.StatusMethodNotAllowed || rw.Header().Get("Allow") != "POST" {
+		t.Error("GET was allowed", rw.Code)
+	}
+
+	for origin, code := range map[string]int{"http://evil.com": http.StatusForbidden, "http://example.com": http.StatusOK} {
+		req = httptest.NewRequest("POST", "http://example.com/workers/A/stop", nil)
+		req.TLS = verified
+		req.Header.Set("Origin", origin)
+		rw = httptest.NewRecorder()
+		l.Worker(rw, req)
+		if rw.Code != code {
+			t.Error("unexpected answer to", origin, rw.Code, rw.Body.String())
+		}
+	}
+
+	// Without Tokens and a ClientCA everything is open.
+	l.Security = config.Security{}
+	rw = httptest.NewRecorder()
+	l.Start(rw, httptest.NewRequest("POST", "/start", nil))
+	if rw.Code != http.StatusOK {
+		t.Error("start was refused", rw.Code)
+	}
+}
+
+func TestCORS(t *testing.T) {
+	l := &Lead{Core: core.Core{Name_: "Test"}}
+	l.Init()
+
+	h := l.cors(http.HandlerFunc(l.Cache))
+
+	call := func(method, origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/cache", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		if method == http.MethodOptions {
+			req.Header.Set("Access-Control-Request-Method", "GET")
+		}
+
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, req)
+		return rw
+	}
+
+	// No origin is allowed by default.
+	if rw := call("GET", "http://example.com"); rw.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Error("origin allowed by default")
+	}
+
+	l.Security.AllowedOrigins = []string{"http://example.com"}
+
+	rw := call("GET", "http://example.com")
+	if rw.Header().Get("Access-Control-Allow-Origin") != "http://example.com" || rw.Header().Get("Vary") != "Origin" {
+		t.Error("unexpected headers", rw.Header())
+	}
+
+	if rw := call("GET", "http://evil.com"); rw.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Error("unlisted origin allowed")
+	}
+
+	rw = call(http.MethodOptions, "http://example.com")
+	if rw.Code != http.StatusNoContent || !strings.Contains(rw.Header().Get("Access-Control-Allow-Headers"), "Authorization") {
+		t.Error("unexpected preflight", rw.Code, rw.Header())
+	}
+
+	l.Security.AllowedOrigins = []string{"*"}
+	if rw := call("GET", "http://evil.com"); rw.Header().Get("Access-Control-Allow-Origin") != "http://evil.com" {
+		t.Error("any origin not allowed")
+	}
+}
+
+func TestCluster(t *testing.T) {
+	log.Init(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
+
+	defer func(d time.Duration) { controlTimeout = d }(controlTimeout)
+	controlTimeout = time.Millisecond * 100
+
+	// The peer answers for every node.
+	mgmt := control.NewPort("MGMT_Cluster")
+	p := &Lead{Core: core.Core{Name_: "Peer"}, Ports: map[string]connector.Connector{"Cluster": mgmt}}
+	w := &controlWorker{
+		worker.Work{Core: core.Core{Name_: "Cluster"}, Ports_: map[string]connector.Connector{"MGMT_Cluster": mgmt}},
+		"Healthy",
+	}
+	p.Workers = append(p.Workers, w)
+	p.Init()
+	go w.Run()
+	defer control.Ask(context.Background(), mgmt, control.Stop)
+
+	w.Metrics().Counter("Processed").Add(3)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", p.Status)
+	mux.HandleFunc("/metrics", p.Metrics)
+	mux.HandleFunc("/cache", p.Cache)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+	l := &Lead{
+		Core: core.Core{Name_: "Test"},
+		GUI_port: port,
+		Nodes: []config.NodeConfig{{Hostname: "127.0.0.1"}, {Hostname: "localhost"}},
+	}
+	l.Init()
+
+	type result struct {
+		Success bool
+		Message struct {
+			Nodes       map[string]NodeAnswer
+			Reachable   int
+			Unreachable int
+			Health      string
+			Cluster     metrics.Snapshot
+		}
+	}
+
+	call := func(path string) (res result) {
+		rw := httptest.NewRecorder()
+		l.Cluster(rw, httptest.NewRequest("GET", path, nil))
+
+		if err := json.Unmarshal(rw.Body.Bytes(), &res); err != nil {
+			t.Fatal(err, rw.Body.String())
+		}
+		return
+	}
+
+	res := call("/cluster/status")
+	if !res.Success || res.Message.Health != "Healthy" || res.Message.Reachable != 2 || res.Message.Unreachable != 0 {
+		t.Error("unexpected status", res)
+	}
+
+	for host, a := range res.Message.Nodes {
+		if !a.Reachable || !a.Success || a.LatencyMs <= 0 || !strings.Contains(string(a.Message), `"Cluster"`) {
+			t.Error("unexpected answer of", host, a)
+		}
+	}
+
+	if res := call("/cluster/metrics"); !res.Success || res.Message.Cluster.Counters["Processed"] != 6 {
+		t.Error("unexpected metrics", res)
+	}
+
+	if res := call("/cluster/cache"); !res.Success || !strings.Contains(string(res.Message.Nodes["localhost"].Message), `"Processed":3`) {
+		t.Error("unexpected cache", res)
+	}
+
+	// Nothing listens on 127.0.0.2.
+	l.Nodes = append(l.Nodes, config.NodeConfig{Hostname: "127.0.0.2"})
+
+	res = call("/cluster/status")
+	if res.Success || res.Message.Health != "Unknown" || res.Message.Reachable != 2 || res.Message.Unreachable != 1 {
+		t.Error("unexpected status", res)
+	}
+
+	if a := res.Message.Nodes["127.0.0.2"]; a.Reachable || a.Error == "" {
+		t.Error("unexpected answer", a)
+	}
+
+	rw := httptest.NewRecorder()
+	l.Cluster(rw, httptest.NewRequest("GET", "/cluster/explode", nil))
+	if !strings.Contains(rw.Body.String(), `"success":false`) {
+		t.Error("unknown cluster request succeeded", rw.Body.String())
+	}
+}
+
+func TestPeers(t *testing.T) {
+	log.Init(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
+
+	defer func(s, d time.Duration) { suspectAfter, deadAfter = s, d }(suspectAfter, deadAfter)
+	suspectAfter, deadAfter = time.Millisecond*100, time.Millisecond*200
+
+	p := &Lead{Core: core.Core{Name_: "Peer"}}
+	p.Init()
+	server := httptest.NewServer(http.HandlerFunc(p.Heartbeat))
+
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+	// Nothing listens on 127.0.0.2 and the node named like the
+	// leader is its own.
+	l := &Lead{
+		Core: core.Core{Name_: "Test"},
+		GUI_port: port,
+		Nodes: []config.NodeConfig{{Hostname: "Test"}, {Hostname: "127.0.0.1"}, {Hostname: "127.0.0.2"}},
+	}
+	l.Init()
+
+	events, cancel := l.Subscribe()
+	defer cancel()
+
+	peers := func() map[string]PeerStatus {
+		rw := httptest.NewRecorder()
+		l.Peers(rw, httptest.NewRequest("GET", "/peers", nil))
+
+		var res struct {
+			Success bool
+			Message map[string]PeerStatus
+		}
+		if err := json.Unmarshal(rw.Body.Bytes(), &res); err != nil || !res.Success {
+			t.Fatal(err, rw.Body.String())
+		}
+		return res.Message
+	}
+
+	if ps := peers(); len(ps) != 2 || ps["127.0.0.1"].State != PeerUnknown {
+		t.Error("unexpected peers", ps)
+	}
+
+	started := time.Now()
+	l.beat(http.DefaultClient, l.peers(), started)
+
+	ps := peers()
+	if ps["127.0.0.1"].State != PeerAlive || ps["127.0.0.1"].LastSeen.IsZero() {
+		t.Error("unexpected peer", ps["127.0.0.1"])
+	}
+
+	if ps["127.0.0.2"].State != PeerUnknown || ps["127.0.0.2"].Misses != 1 || ps["127.0.0.2"].Error == "" {
+		t.Error("unexpected peer", ps["127.0.0.2"])
+	}
+
+	select {
+	case ev := <-events:
+		data := ev.Data.(map[string]string)
+		if ev.Kind != EventPeer || data["Peer"] != "127.0.0.1" || data["To"] != PeerAlive {
+			t.Error("unexpected event", ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no peer event")
+	}
+
+	server.Close()
+
+	time.Sleep(suspectAfter)
+	l.beat(http.DefaultClient, l.peers(), started)
+
+	if s, _ := l.cache.Peer("127.0.0.1"); s.State != PeerSuspect || s.Misses != 1 {
+		t.Error("unexpected peer", s)
+	}
+
+	time.Sleep(deadAfter - suspectAfter)
+	l.beat(http.DefaultClient, l.peers(), started)
+
+	ps = peers()
+	if ps["127.0.0.1"].State != PeerDead || ps["127.0.0.2"].State != PeerDead {
+		t.Error("unexpected peers", ps)
+	}
+
+	// The cache holds the peers as well.
+	rw := httptest.NewRecorder()
+	l.Cache(rw, httptest.NewRequest("GET", "/cache", nil))
+	if !strings.Contains(rw.Body.String(), `"127.0.0.2":{"State":"Dead"`) {
+		t.Error("unexpected cache", rw.Body.String())
+	}
+}
+
+func TestMetricsHistory(t *testing.T) {
+	log.Init(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
+
+	defer func(d time.Duration) { controlTimeout = d }(controlTimeout)
+	controlTimeout = time.Millisecond * 100
+
+	mgmt := control.NewPort("MGMT_History")
+	l := &Lead{
+		Core: core.Core{Name_: "Test"},
+		Ports: map[string]connector.Connector{"History": mgmt},
+		History: config.History{Samples: 10},
+	}
+	w := &controlWorker{
+		worker.Work{Core: core.Core{Name_: "History"}, Ports_: map[string]connector.Connector{"MGMT_History": mgmt}},
+		"Healthy",
+	}
+	l.Workers = append(l.Workers, w)
+	l.Init()
+	stopLead(t, l)
+	l.startWorker(w)
+
+	// More samples than are kept, a second apart.
+	start := time.Now().Add(-time.Minute)
+	for i := 0; i < 15; i++ {
+		w.Metrics().Counter("Processed").Inc()
+		w.Metrics().Gauge("Depth").Set(float64(i))
+		l.record(start.Add(time.Second * time.Duration(i)))
+	}
+
+	call := func(query string) (bool, map[string][]Sample) {
+		rw := httptest.NewRecorder()
+		l.MetricsHistory(rw, httptest.NewRequest("GET", "/metrics/history"+query, nil))
+
+		var res struct {
+			Success bool
+			Message struct {
+				Workers map[string][]Sample
+			}
+		}
+		json.Unmarshal(rw.Body.Bytes(), &res)
+		return res.Success, res.Message.Workers
+	}
+
+	ok, workers := call("?worker=History")
+	samples := workers["History"]
+	if !ok || len(samples) != 10 {
+		t.Fatal("unexpected history", samples)
+	}
+
+	// The oldest samples were overwritten, the rest are in order.
+	for i, s := range samples {
+		if s.Registry.Counters["Processed"] != uint64(i+6) || s.Metric == nil {
+			t.Error("unexpected sample", i, s)
+		}
+	}
+
+	since := start.Add(time.Second * 11).Format(time.RFC3339Nano)
+	if _, workers := call("?since=" + since); len(workers["History"]) != 3 {
+		t.Error("unexpected samples since", since, workers)
+	}
+
+	// Zero is the epoch, not a duration of zero.
+	if _, workers := call("?since=0"); len(workers["History"]) != 10 {
+		t.Error("unexpected samples since the epoch", workers)
+	}
+
+	// Three steps of three samples and one of the last sample.
+	_, workers = call("?worker=History&step=3s")
+	samples = workers["History"]
+	if len(samples) != 4 {
+		t.Fatal("unexpected downsampling", samples)
+	}
+
+	if samples[0].Registry.Counters["Processed"] != 8 || samples[0].Registry.Gauges["Depth"] != 6 {
+		t.Error("unexpected sample", samples[0])
+	}
+
+	if _, workers := call("?points=2"); len(workers["History"]) > 2 {
+		t.Error("unexpected points", workers["History"])
+	}
+
+	for _, query := range []string{"?worker=Missing", "?since=yesterday", "?step=-1s", "?points=0"} {
+		if ok, _ := call(query); ok {
+			t.Error(query, "succeeded")
+		}
+	}
+}
+
+// A worker that keeps running for a while after it answered 
+// a stop and counts how many of its Runs are running.
+type lingerWorker struct {
+	worker.Work
+	linger  time.Duration
+	running int32
+	overlap int32
+}
+
+func (w *lingerWorker) Init() {}
+
+func (w *lingerWorker) Run() {
+	if atomic.AddInt32(&w.running, 1) > 1 {
+		atomic.StoreInt32(&w.overlap, 1)
+	}
+	defer atomic.AddInt32(&w.running, -1)
+
+	for req := range w.Control() {
+		if w.Serve(req, nil, nil) {
+			time.Sleep(w.linger)
+			return
+		}
+	}
+}
+
+func TestRerun(t *testing.T) {
+	log.Init(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
+
+	defer func(d time.Duration) { returnTimeout = d }(returnTimeout)
+	returnTimeout = time.Millisecond * 500
+
+	mgmt := control.NewPort("MGMT_Linger")
+	w := &lingerWorker{
+		Work: worker.Work{Core: core.Core{Name_: "Linger"}, Ports_: map[string]connector.Connector{"MGMT_Linger": mgmt}},
+		linger: time.Millisecond * 100,
+	}
+
+	l := &Lead{Core: core.Core{Name_: "Test"}, Workers: []worker.Worker{w}, Ports: map[string]connector.Connector{"Linger": mgmt}}
+	l.Init()
+	stopLead(t, l)
+	l.startWorker(w)
+
+	call := func(path string) string {
+		rw := httptest.NewRecorder()
+		l.Worker(rw, httptest.NewRequest("POST", path, nil))
+		return rw.Body.String()
+	}
+
+	if body := call("/workers/Linger/restart"); !strings.Contains(body, `"success":true`) {
+		t.Error("restart failed", body)
+	}
+
+	if atomic.LoadInt32(&w.overlap) != 0 {
+		t.Error("the worker was run twice at once")
+	}
+
+	// A Run that does not return in time is not run again.
+	w.linger = time.Second
+	if body := call("/workers/Linger/restart"); !strings.Contains(body, `"success":false`) {
+		t.Error("restart succeeded", body)
+	}
+
+	if atomic.LoadInt32(&w.overlap) != 0 {
+		t.Error("the worker was run twice at once")
+	}
+
+	// A worker waiting to be restarted is started at once.
+	c := &crashingWorker{worker.Work{Core: core.Core{Name_: "Crash"}}, make(chan int, 10), 0}
+	o := &Lead{
+		Workers: []worker.Worker{c},
+		Ports: map[string]connector.Connector{"Crash": control.NewPort("MGMT_Crash")},
+		Policies: map[string]Policy{"Crash": {Restart: config.RestartAlways, Backoff: time.Minute}},
+	}
+	o.Init()
+	stopLead(t, o)
+	o.startWorker(c)
+	<-c.runs
+
+	for {
+		if c, _ := o.cache.Get("Crash"); c.State == "Restarting" {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	rw := httptest.NewRecorder()
+	o.Start(rw, httptest.NewRequest("POST", "/start", nil))
+	if !strings.Contains(rw.Body.String(), `"success":true`) {
+		t.Error("start failed", rw.Body.String())
+	}
+
+	select {
+	case <-c.runs:
+	case <-time.After(returnTimeout):
+		t.Error("restarting worker was not started")
+	}
 }
@@ -0,0 +1,188 @@
+package leader
+
+import (
+	"github.com/go-emd/emd/log"
+	"context"
+	"net/http"
+	"os"
+	"time"
+)
+
+// How often the leader sends a heartbeat to every peer, how
+// long a peer may go unheard before it is Suspect and before
+// it is Dead.
+var (
+	heartbeatInterval = time.Second
+	suspectAfter      = time.Second * 3
+	deadAfter         = time.Second * 10
+)
+
+// The liveness of a peer.  A peer is Unknown until it is first
+// heard from or until it has been unheard for deadAfter.
+const (
+	PeerUnknown = "Unknown"
+	PeerAlive   = "Alive"
+	PeerSuspect = "Suspect"
+	PeerDead    = "Dead"
+)
+
+// The liveness of another node leader as seen by the leader.
+// LastSeen is when it last answered a heartbeat and LatencyMs
+// how long that took, Misses counts the heartbeats it missed
+// in a row since and Error tells why the last one was missed.
+type PeerStatus struct {
+	State     string
+	LastSeen  time.Time
+	LatencyMs float64
+	Misses    int
+	Error     string `json:",omitempty"`
+}
+
+// Returns the hostnames of the other node leaders of the
+// distribution, the node named like the leader or like the
+// host it runs on is the leader's own.
+func (l *Lead) peers() []string {
+	self, _ := os.Hostname()
+
+	var hostnames []string
+	for _, n := range l.Nodes {
+		if n.Hostname != l.Name_ && n.Hostname != self {
+			hostnames = append(hostnames, n.Hostname)
+		}
+	}
+
+	return hostnames
+}
+
+// Sends a heartbeat to every peer each heartbeatInterval
+// until the leader exits.
+func (l *Lead) heartbeats() {
+	hostnames := l.peers()
+	if len(hostnames) == 0 {
+		return
+	}
+
+	client, err := l.Security.Client()
+	if err != nil {
+		log.ERROR.Println(err)
+		return
+	}
+
+	started := time.Now()
+
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			l.beat(client, hostnames, started)
+		case <-l.exiting():
+			return
+		}
+	}
+}
+
+// Sends a heartbeat to each of the peers at once and updates
+// their liveness with the answers.  A peer never heard from
+// is Dead once deadAfter has passed since the heartbeats
+// started.
+func (l *Lead) beat(client *http.Client, hostnames []string, started time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), heartbeatInterval)
+	defer cancel()
+
+	answers := make(chan NodeAnswer, len(hostnames))
+	for _, hostname := range hostnames {
+		go func(hostname string) {
+			a := l.askNode(ctx, client, hostname, "/heartbeat")
+
+			l.cache.UpdatePeer(hostname, func(p *PeerStatus) {
+				if a.Reachable && a.Success {
+					p.LastSeen = time.Now()
+					p.LatencyMs = a.LatencyMs
+					p.Misses = 0
+					p.Error = ""
+				} else {
+					p.Misses += 1
+					p.Error = a.Error
+				}
+
+				p.State = liveness(p.LastSeen, started)
+			})
+
+			answers <- a
+		}(hostname)
+	}
+
+	for range hostnames {
+		<-answers
+	}
+}
+
+// Returns the state of a peer last seen at the given time.
+func liveness(lastSeen, started time.Time) string {
+	if lastSeen.IsZero() {
+		if time.Since(started) < deadAfter {
+			return PeerUnknown
+		}
+		return PeerDead
+	}
+
+	switch since := time.Since(lastSeen); {
+	case since < suspectAfter:
+		return PeerAlive
+	case since < deadAfter:
+		return PeerSuspect
+	default:
+		return PeerDead
+	}
+}
+
+// Publishes the state changes of a peer, called by the cache
+// on every update.
+func (l *Lead) peerChanged(hostname string, before, after PeerStatus) {
+	if before.State != after.State {
+		l.events.publish(EventPeer, "", map[string]string{
+			"Peer": hostname,
+			"From": before.State,
+			"To": after.State,
+		})
+	}
+}
+
+// A REST endpoint answering the heartbeats of the other node
+// leaders with the name of the leader and its time.
+func (l *Lead) Heartbeat(rw http.ResponseWriter, r *http.Request) {
+	Respond(rw, true, map[string]interface{}{
+		"Name": l.Name_,
+		"Time": time.Now(),
+	})
+	return
+}
+
+// A REST endpoint that returns the liveness of every peer.
+func (l *Lead) Peers(rw http.ResponseWriter, r *http.Request) {
+	Respond(rw, true, l.cache.Snapshot().Peers)
+	return
+}
+
+// Subscribes to the events of the leader, such as a peer
+// becoming Dead, for the workers of the node to react to.
+// The events are received from the channel until the returned
+// func is called or the leader exits, a subscriber that falls
+// too far behind has its channel closed.
+//
+// Example:
+//
+//	events, cancel := lead.Subscribe()
+//	defer cancel()
+//
+//	for ev := range events {
+//		if ev.Kind == leader.EventPeer {
+//			// Stop sending to the peer...
+//		}
+//	}
+func (l *Lead) Subscribe() (<-chan Event, func()) {
+	_, ch := l.events.subscribe(^uint64(0))
+	return ch, func() { l.events.unsubscribe(ch) }
+}
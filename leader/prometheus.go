@@ -0,0 +1,261 @@
+package leader
+
+import (
+	"github.com/go-emd/emd/connector"
+	"github.com/go-emd/emd/control"
+	"github.com/go-emd/emd/metrics"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The states and healths a worker can be in, each one is
+// exported as its own series so they can be graphed.
+var (
+	workerStates  = []string{"Initialized", "Running", "Restarting", "Exited", "Crashed", "Failed", "Stopped", "Unknown"}
+	workerHealths = []string{"Healthy", "Unhealthy", "Unknown"}
+)
+
+// The series exported for every port of every worker.
+var portSeries = []struct {
+	name, kind, help string
+	value            func(connector.Stats) float64
+}{
+	{"emd_port_messages_sent_total", "counter", "Values the port's connector sent.",
+		func(s connector.Stats) float64 { return float64(s.Sent) }},
+	{"emd_port_messages_received_total", "counter", "Values the port's connector received.",
+		func(s connector.Stats) float64 { return float64(s.Received) }},
+	{"emd_port_bytes_sent_total", "counter", "Bytes the port's connector wrote on the wire.",
+		func(s connector.Stats) float64 { return float64(s.BytesSent) }},
+	{"emd_port_bytes_received_total", "counter", "Bytes the port's connector read off the wire.",
+		func(s connector.Stats) float64 { return float64(s.BytesReceived) }},
+	{"emd_port_encode_errors_total", "counter", "Values the port's connector could not encode.",
+		func(s connector.Stats) float64 { return float64(s.EncodeErrors) }},
+	{"emd_port_decode_errors_total", "counter", "Values the port's connector could not decode.",
+		func(s connector.Stats) float64 { return float64(s.DecodeErrors) }},
+	{"emd_port_dropped_total", "counter", "Values the port's connector dropped.",
+		func(s connector.Stats) float64 { return float64(s.Dropped) }},
+	{"emd_port_channel_depth", "gauge", "Values waiting in the channel of the worker's port.",
+		func(s connector.Stats) float64 { return float64(s.Length) }},
+	{"emd_port_channel_capacity", "gauge", "Capacity of the channel of the worker's port.",
+		func(s connector.Stats) float64 { return float64(s.Capacity) }},
+}
+
+// Writes series in the Prometheus text exposition format.
+type exposition struct {
+	bytes.Buffer
+	node string
+}
+
+// Writes the HELP and TYPE lines of a metric.
+func (e *exposition) metric(name, kind, help string) {
+	fmt.Fprintf(e, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// Writes a single sample of the metric, the node label is
+// added to the given label pairs.
+func (e *exposition) sample(name string, value float64, labels ...string) {
+	e.WriteString(name + `{node="` + escapeLabel(e.node) + `"`)
+
+	for i := 0; i+1 < len(labels); i += 2 {
+		e.WriteString("," + labels[i] + `="` + escapeLabel(labels[i+1]) + `"`)
+	}
+
+	e.WriteString("} " + strconv.FormatFloat(value, 'g', -1, 64) + "\n")
+}
+
+// Writes the cumulative buckets, the sum and the count of a
+// histogram's snapshot.
+func (e *exposition) histogram(name string, h metrics.HistogramSnapshot, labels ...string) {
+	var count uint64
+	for i, c := range h.Counts {
+		count += c
+
+		le := "+Inf"
+		if i < len(h.Bounds) {
+			le = strconv.FormatFloat(h.Bounds[i], 'g', -1, 64)
+		}
+
+		e.sample(name+"_bucket", float64(count), append(labels, "le", le)...)
+	}
+
+	e.sample(name+"_sum", h.Sum, labels...)
+	e.sample(name+"_count", float64(h.Count), labels...)
+}
+
+// Escapes a label value as the text format requires.
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+// A REST endpoint that returns the metrics of the leader
+// in the Prometheus text exposition format so they can be
+// scraped.  Every series is labelled with the node and the
+// worker, the numeric fields the workers report are exported
+// as emd_worker_metric with the field's name as a label and
+// the metrics.Registry of each worker as emd_worker_counter,
+// emd_worker_gauge and emd_worker_histogram.
+func (l *Lead) Prometheus(rw http.ResponseWriter, r *http.Request) {
+	answers := l.askAll(r.Context(), control.Metrics)
+	for _, a := range answers {
+		l.metrics(a)
+	}
+
+	workers := l.cache.Snapshot().Workers
+
+	names := sortedKeys(workers)
+
+	e := &exposition{node: l.Name_}
+
+	e.metric("emd_worker_state", "gauge", "Current state of the worker, 1 for the state it is in.")
+	for _, k := range names {
+		for _, state := range workerStates {
+			e.sample("emd_worker_state", boolValue(workers[k].State == state), "worker", k, "state", state)
+		}
+	}
+
+	e.metric("emd_worker_health", "gauge", "Last known health of the worker, 1 for the health it has.")
+	for _, k := range names {
+		for _, health := range workerHealths {
+			e.sample("emd_worker_health", boolValue(workers[k].Health == health), "worker", k, "health", health)
+		}
+	}
+
+	e.metric("emd_worker_restarts_total", "counter", "Times the worker was restarted by its supervisor.")
+	for _, k := range names {
+		e.sample("emd_worker_restarts_total", float64(workers[k].Restarts), "worker", k)
+	}
+
+	e.metric("emd_worker_crashes_total", "counter", "Times the worker panicked.")
+	for _, k := range names {
+		e.sample("emd_worker_crashes_total", float64(workers[k].Crashes), "worker", k)
+	}
+
+	ports := make(map[string]map[string]connector.Stats, len(names))
+	for _, k := range names {
+		ports[k] = l.portStats(k)
+	}
+
+	for _, s := range portSeries {
+		e.metric(s.name, s.kind, s.help)
+		for _, k := range names {
+			for _, p := range sortedKeys(ports[k]) {
+				e.sample(s.name, s.value(ports[k][p]), "worker", k, "port", p)
+			}
+		}
+	}
+
+	e.metric("emd_worker_metric", "gauge", "Numeric metric reported by the worker.")
+	for _, k := range names {
+		a, ok := answers[k]
+		if !ok || a.err != nil {
+			continue
+		}
+
+		fields := numericFields(a.response.Value)
+		for _, f := range sortedKeys(fields) {
+			e.sample("emd_worker_metric", fields[f], "worker", k, "metric", f)
+		}
+	}
+
+	registries := make(map[string]metrics.Snapshot, len(names))
+	for _, k := range names {
+		registries[k] = l.registry(k)
+	}
+
+	e.metric("emd_worker_counter_total", "counter", "Counter of the worker's metrics registry.")
+	for _, k := range names {
+		counters := registries[k].Counters
+		for _, c := range sortedKeys(counters) {
+			e.sample("emd_worker_counter_total", float64(counters[c]), "worker", k, "name", c)
+		}
+	}
+
+	e.metric("emd_worker_gauge", "gauge", "Gauge of the worker's metrics registry.")
+	for _, k := range names {
+		gauges := registries[k].Gauges
+		for _, g := range sortedKeys(gauges) {
+			e.sample("emd_worker_gauge", gauges[g], "worker", k, "name", g)
+		}
+	}
+
+	e.metric("emd_worker_histogram", "histogram", "Histogram of the worker's metrics registry.")
+	for _, k := range names {
+		histograms := registries[k].Histograms
+		for _, h := range sortedKeys(histograms) {
+			e.histogram("emd_worker_histogram", histograms[h], "worker", k, "name", h)
+		}
+	}
+
+	rw.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	rw.Write(e.Bytes())
+}
+
+// Returns the numeric fields of the metrics a worker reported,
+// nested fields are joined with a dot.  A worker reporting a
+// single number has it returned as the field value.
+func numericFields(value interface{}) map[string]float64 {
+	fields := make(map[string]float64)
+
+	// Go through json so any struct or map of the worker is
+	// turned into maps of float64s.
+	b, err := json.Marshal(value)
+	if err != nil {
+		return fields
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return fields
+	}
+
+	flatten("", v, fields)
+	return fields
+}
+
+// Adds the numbers within v to the fields under the prefix.
+func flatten(prefix string, v interface{}, fields map[string]float64) {
+	switch v := v.(type) {
+	case float64:
+		if prefix == "" {
+			prefix = "value"
+		}
+		fields[prefix] = v
+	case bool:
+		if prefix == "" {
+			prefix = "value"
+		}
+		fields[prefix] = boolValue(v)
+	case map[string]interface{}:
+		for k, e := range v {
+			if prefix != "" {
+				k = prefix + "." + k
+			}
+			flatten(k, e, fields)
+		}
+	}
+}
+
+// Returns the keys of the map in order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// Returns 1 for true and 0 for false.
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
@@ -26,9 +26,15 @@ func (r Response) String() (s string) {
 }
 
 // Sets the REST headers for the json response and sends the 
-// json serialized data with it.
+// json serialized data with it.  Which origins may read it is 
+// left to the leader's CORS allow-list.
 func Respond(rw http.ResponseWriter, success bool, message interface{}) {
-	rw.Header().Set("Access-Control-Allow-Origin", "*")
+	respond(rw, http.StatusOK, success, message)
+}
+
+// Same as Respond but with the status code of the response.
+func respond(rw http.ResponseWriter, code int, success bool, message interface{}) {
 	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(code)
 	fmt.Fprint(rw, Response{"success": success, "message": message})
 }
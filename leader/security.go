@@ -0,0 +1,117 @@
+package leader
+
+import (
+	"github.com/go-emd/emd/config"
+	"crypto/subtle"
+	"crypto/tls"
+	"net/http"
+	"strings"
+)
+
+// Returns the TLS configuration of the REST server.  When a
+// ClientCA is set clients may present a certificate signed by
+// it in place of a token, so one is asked for but not required.
+func (l *Lead) tlsConfig() (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if l.Security.ClientCA != "" {
+		pool, err := config.CertPool(l.Security.ClientCA)
+		if err != nil {
+			return nil, err
+		}
+
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return cfg, nil
+}
+
+// Returns true if the request may change the distribution.
+// Without Tokens or a ClientCA every request may, otherwise it
+// needs a verified client certificate or one of the Tokens as
+// a bearer token.  A request that may not is answered with a
+// 401.
+func (l *Lead) authorize(rw http.ResponseWriter, r *http.Request) bool {
+	s := l.Security
+	if len(s.Tokens) == 0 && s.ClientCA == "" {
+		return true
+	}
+
+	if s.ClientCA != "" && r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		return true
+	}
+
+	auth := r.Header.Get("Authorization")
+	if strings.HasPrefix(auth, "Bearer ") {
+		token := []byte(strings.TrimPrefix(auth, "Bearer "))
+
+		for _, t := range s.Tokens {
+			if subtle.ConstantTimeCompare(token, []byte(t)) == 1 {
+				return true
+			}
+		}
+	}
+
+	rw.Header().Set("WWW-Authenticate", `Bearer realm="emd"`)
+	respond(rw, http.StatusUnauthorized, false, "Unauthorized.")
+	return false
+}
+
+// Returns true if the request is a POST from the leader's own 
+// pages, one of the AllowedOrigins or a client that is not a 
+// browser.  Only such requests may change the distribution, so 
+// another page cannot have a browser holding a client 
+// certificate do it with a link or a form.  A request that may 
+// not is answered with a 405 or a 403.
+func (l *Lead) post(rw http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		rw.Header().Set("Allow", http.MethodPost)
+		respond(rw, http.StatusMethodNotAllowed, false, "Use POST.")
+		return false
+	}
+
+	origin := r.Header.Get("Origin")
+	if origin == "" || l.allowed(origin) || strings.TrimPrefix(strings.TrimPrefix(origin, "https://"), "http://") == r.Host {
+		return true
+	}
+
+	respond(rw, http.StatusForbidden, false, "Origin " + origin + " is not allowed.")
+	return false
+}
+
+// Wraps the handler adding the CORS headers for the origins
+// in the AllowedOrigins and answering their preflight requests.
+// Requests from any other origin get no CORS headers, so
+// browsers keep other pages from reading the answers.
+func (l *Lead) cors(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if len(l.Security.AllowedOrigins) > 0 {
+			rw.Header().Add("Vary", "Origin")
+		}
+
+		if origin := r.Header.Get("Origin"); origin != "" && l.allowed(origin) {
+			rw.Header().Set("Access-Control-Allow-Origin", origin)
+			rw.Header().Set("Access-Control-Allow-Headers", "Authorization")
+
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				rw.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+				rw.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+
+		h.ServeHTTP(rw, r)
+	})
+}
+
+// Returns true if the origin is one of the AllowedOrigins.
+func (l *Lead) allowed(origin string) bool {
+	for _, o := range l.Security.AllowedOrigins {
+		if o == "*" || o == origin {
+			return true
+		}
+	}
+
+	return false
+}
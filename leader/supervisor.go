@@ -0,0 +1,233 @@
+package leader
+
+import (
+	"github.com/go-emd/emd/config"
+	"github.com/go-emd/emd/log"
+	"github.com/go-emd/emd/worker"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The bounds of the wait between two restarts of a worker,
+// the wait starts at the policy's Backoff, or the default,
+// and doubles after every restart.
+var (
+	defaultBackoff = time.Second
+	maxBackoff     = time.Minute
+)
+
+// Tells the leader what to do once a worker's Run returns
+// or panics.  The Restart is one of the config.Restart
+// policies, MaxRestarts limits the number of restarts with
+// zero meaning no limit and Backoff is the first wait between
+// restarts.
+type Policy struct {
+	Restart     string
+	MaxRestarts int
+	Backoff     time.Duration
+}
+
+// Returns the restart policy of the worker's configuration.
+func NewPolicy(w config.WorkConfig) Policy {
+	p := Policy{Restart: w.Restart, MaxRestarts: w.MaxRestarts}
+
+	if w.Backoff != "" {
+		if d, err := time.ParseDuration(w.Backoff); err == nil {
+			p.Backoff = d
+		} else {
+			log.WARNING.Println("Worker: " + w.Name + " has an invalid backoff " + w.Backoff)
+		}
+	}
+
+	return p
+}
+
+// Returns true if the worker should be restarted after
+// its Run returned, crashed tells whether it panicked.
+func (p Policy) restarts(crashed bool) bool {
+	switch p.Restart {
+	case config.RestartAlways:
+		return true
+	case config.RestartOnFailure:
+		return crashed
+	}
+
+	return false
+}
+
+// Runs a single worker for the leader, recovering from its
+// panics and restarting it according to its policy until the
+// leader stops it.
+type supervisor struct {
+	lead   *Lead
+	worker worker.Worker
+	policy Policy
+
+	mu       sync.Mutex
+	running  bool
+	stopping bool
+	stopped  chan struct{}
+	done     chan struct{}
+}
+
+// Starts supervising the worker in its own go routine, the
+// worker's ports must already be open.
+func (l *Lead) supervise(w worker.Worker) *supervisor {
+	s := &supervisor{
+		lead: l,
+		worker: w,
+		policy: l.Policies[w.Name()],
+		running: true,
+		stopped: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+
+	go s.run()
+	return s
+}
+
+// Runs the worker until it returns without being restarted
+// or the leader stops it.
+func (s *supervisor) run() {
+	defer close(s.done)
+
+	name := s.worker.Name()
+	backoff := s.policy.Backoff
+	if backoff <= 0 {
+		backoff = defaultBackoff
+	}
+
+	for restarts := 0; ; restarts++ {
+		reason, crashed := s.runOnce(restarts > 0)
+
+		if crashed {
+			log.ERROR.Println("Worker: " + name + " crashed: " + reason)
+		} else {
+			log.WARNING.Println("Worker: " + name + " returned.")
+		}
+
+		restart := s.policy.restarts(crashed) &&
+			(s.policy.MaxRestarts == 0 || restarts < s.policy.MaxRestarts)
+
+		if !s.exited(crashed, reason, restart) {
+			return
+		}
+
+		if !restart {
+			return
+		}
+
+		log.INFO.Println("Worker: " + name + " restarts in " + backoff.String() + ", restart " + strconv.Itoa(restarts+1) + ".")
+
+		select {
+		case <-time.After(backoff):
+		case <-s.stopped:
+			return
+		}
+
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+
+		if !s.restarting() {
+			return
+		}
+	}
+}
+
+// Records that the worker's Run returned.  Returns false when
+// the leader stopped the worker, in which case the leader
+// records its state.  A worker that is not restarted has its
+// ports closed first so it can be started again as soon as
+// its state tells it is no longer running.
+func (s *supervisor) exited(crashed bool, reason string, restart bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.running = false
+	if s.stopping {
+		return false
+	}
+
+	if !restart {
+		s.lead.closePorts(s.worker.Name())
+	}
+
+	state := "Exited"
+	if restart {
+		state = "Restarting"
+	} else if crashed {
+		state = "Crashed"
+	}
+
+	s.lead.cache.Update(s.worker.Name(), func(c *WorkerCache) {
+		c.State = state
+		if crashed {
+			c.Crashes += 1
+			c.Reason = reason
+		}
+	})
+
+	return true
+}
+
+// Records that the worker is restarted.  Returns false when
+// the leader stopped the worker in the meantime.
+func (s *supervisor) restarting() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopping {
+		return false
+	}
+
+	s.running = true
+	s.lead.cache.Update(s.worker.Name(), func(c *WorkerCache) {
+		c.State = "Running"
+		c.Restarts += 1
+	})
+
+	return true
+}
+
+// Runs the worker once, initializing it again first when it
+// is restarted.  Returns the reason and true if it panicked.
+func (s *supervisor) runOnce(init bool) (reason string, crashed bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			reason, crashed = fmt.Sprint(r), true
+		}
+	}()
+
+	if init {
+		s.worker.Init()
+	}
+
+	s.worker.Run()
+	return "", false
+}
+
+// Tells the supervisor the leader is stopping the worker so
+// it is not restarted.  Returns true if the worker is running
+// and needs to be asked to stop, otherwise its ports are
+// closed and it is recorded as Stopped.
+func (s *supervisor) stop() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.stopping {
+		s.stopping = true
+		close(s.stopped)
+	}
+
+	if !s.running {
+		s.lead.closePorts(s.worker.Name())
+		s.lead.cache.Update(s.worker.Name(), func(c *WorkerCache) {
+			c.State = "Stopped"
+		})
+	}
+
+	return s.running
+}
@@ -0,0 +1,32 @@
+package leader
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// The files of the dashboard, built into the leader so it
+// needs nothing from outside the cluster.
+//
+//go:embed ui
+var uiFiles embed.FS
+
+// Serves the dashboard files under /ui/.
+var uiHandler = func() http.Handler {
+	files, err := fs.Sub(uiFiles, "ui")
+	if err != nil {
+		panic(err)
+	}
+
+	return http.StripPrefix("/ui/", http.FileServer(http.FS(files)))
+}()
+
+// A REST endpoint serving the web dashboard of the leader.  It
+// shows the workers of the node with buttons to start and stop
+// them, charts the metrics of the cache as they change, lists
+// the events and draws the topology of the distribution from
+// the config file.
+func (l *Lead) UI(rw http.ResponseWriter, r *http.Request) {
+	uiHandler.ServeHTTP(rw, r)
+}
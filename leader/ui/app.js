@@ -0,0 +1,349 @@
+// The dashboard of an emd leader.  It polls /cache for the
+// workers and keeps a short history of every numeric value in
+// the browser to chart it, listens on /events to refresh as
+// soon as something changes and draws the topology from
+// /config, and shows the health of every node of the
+// distribution from /cluster/status.  Everything it needs is
+// served by the leader.  When the leader asks for a token it
+// is prompted for once and kept for the session.
+(function () {
+	"use strict";
+
+	var POLL = 2000;
+	var CLUSTER_POLL = 10000;
+	var HISTORY = 90;
+	var EVENTS = 100;
+
+	// worker -> series -> [values], and the previous sample of
+	// every counter so it can be charted as a rate.
+	var history = {};
+	var previous = {};
+	var lastPoll = 0;
+
+	function $(id) {
+		return document.getElementById(id);
+	}
+
+	function el(tag, text, className) {
+		var e = document.createElement(tag);
+		if (text !== undefined) {
+			e.textContent = text;
+		}
+		if (className) {
+			e.className = className;
+		}
+		return e;
+	}
+
+	function notice(text) {
+		$("notice").textContent = text || "";
+	}
+
+	// Calls an endpoint of the leader and returns its message,
+	// asking for a token and trying again when it is refused.
+	// The method defaults to GET, the actions must POST.
+	function call(path, method, retried) {
+		var headers = {};
+		var token = sessionStorage.getItem("emd-token");
+		if (token) {
+			headers.Authorization = "Bearer " + token;
+		}
+
+		return fetch(path, {method: method || "GET", cache: "no-store", headers: headers}).then(function (r) {
+			if (r.status === 401 && !retried) {
+				token = prompt("Token for " + location.host);
+				if (token) {
+					sessionStorage.setItem("emd-token", token);
+					return call(path, method, true).then(function (message) {
+						return {success: true, message: message};
+					});
+				}
+			}
+			return r.json();
+		}).then(function (res) {
+			if (!res.success) {
+				throw new Error(typeof res.message === "string" ? res.message : JSON.stringify(res.message));
+			}
+			return res.message;
+		});
+	}
+
+	function act(path) {
+		notice("...");
+		return call(path, "POST").then(function (message) {
+			notice(typeof message === "string" ? message : "");
+		}, function (err) {
+			notice(err.message);
+		}).then(refresh);
+	}
+
+	function ago(timestamp) {
+		var s = Math.round((Date.now() - new Date(timestamp).getTime()) / 1000);
+		if (s < 60) {
+			return Math.max(s, 0) + "s ago";
+		}
+		if (s < 3600) {
+			return Math.round(s / 60) + "m ago";
+		}
+		return Math.round(s / 3600) + "h ago";
+	}
+
+	function badge(text, kind) {
+		return el("span", text, kind + " " + text);
+	}
+
+	function renderWorkers(workers) {
+		var body = $("workers").tBodies[0];
+		body.textContent = "";
+
+		Object.keys(workers).sort().forEach(function (name) {
+			var w = workers[name];
+			var row = el("tr");
+
+			row.appendChild(el("td", name));
+			row.appendChild(el("td")).appendChild(badge(w.State, "state"));
+			row.appendChild(el("td")).appendChild(badge(w.Health, "health"));
+			row.appendChild(el("td", String(w.Restarts)));
+
+			var crashes = row.appendChild(el("td", String(w.Crashes)));
+			if (w.Reason) {
+				crashes.title = w.Reason;
+			}
+
+			row.appendChild(el("td", ago(w.Timestamp), "muted"));
+
+			var actions = row.appendChild(el("td"));
+			["start", "stop", "restart"].forEach(function (action) {
+				var b = actions.appendChild(el("button", action, action === "stop" ? "danger" : ""));
+				b.onclick = function () {
+					act("/workers/" + encodeURIComponent(name) + "/" + action);
+				};
+			});
+
+			body.appendChild(row);
+		});
+	}
+
+	// Adds the numeric values of a worker's cache entry to its
+	// history, counters become rates per second.
+	function record(name, w, seconds) {
+		var series = history[name] = history[name] || {};
+		var last = previous[name] = previous[name] || {};
+
+		function push(key, value) {
+			var s = series[key] = series[key] || [];
+			s.push(value);
+			if (s.length > HISTORY) {
+				s.shift();
+			}
+		}
+
+		function rate(key, value) {
+			if (key in last && seconds > 0) {
+				push(key + " /s", Math.max(value - last[key], 0) / seconds);
+			}
+			last[key] = value;
+		}
+
+		var registry = w.Registry || {};
+		Object.keys(registry.Counters || {}).forEach(function (k) {
+			rate(k, registry.Counters[k]);
+		});
+		Object.keys(registry.Gauges || {}).forEach(function (k) {
+			push(k, registry.Gauges[k]);
+		});
+		Object.keys(registry.Histograms || {}).forEach(function (k) {
+			var h = registry.Histograms[k];
+			rate(k + " count", h.Count);
+			push(k + " mean", h.Count ? h.Sum / h.Count : 0);
+		});
+
+		Object.keys(w.Ports || {}).forEach(function (p) {
+			var s = w.Ports[p];
+			push(p + " depth", s.Length);
+			rate(p + " sent", s.Sent);
+			rate(p + " received", s.Received);
+		});
+	}
+
+	function sparkline(values) {
+		var ns = "http://www.w3.org/2000/svg";
+		var width = 160, height = 28;
+		var svg = document.createElementNS(ns, "svg");
+		svg.setAttribute("width", width);
+		svg.setAttribute("height", height);
+
+		var max = Math.max.apply(null, values.concat([0]));
+		var min = Math.min.apply(null, values.concat([0]));
+		var span = max - min || 1;
+
+		var points = values.map(function (v, i) {
+			var x = values.length > 1 ? i * width / (HISTORY - 1) : 0;
+			var y = height - 1 - (v - min) * (height - 2) / span;
+			return x.toFixed(1) + "," + y.toFixed(1);
+		});
+
+		var line = document.createElementNS(ns, "polyline");
+		line.setAttribute("points", points.join(" "));
+		svg.appendChild(line);
+		return svg;
+	}
+
+	function format(v) {
+		if (Math.abs(v) >= 1000 || v === Math.round(v)) {
+			return String(Math.round(v));
+		}
+		return v.toPrecision(3);
+	}
+
+	function renderCharts() {
+		var charts = $("charts");
+		charts.textContent = "";
+
+		Object.keys(history).sort().forEach(function (name) {
+			var series = history[name];
+			var keys = Object.keys(series).sort();
+			if (keys.length === 0) {
+				return;
+			}
+
+			var card = charts.appendChild(el("div", undefined, "card"));
+			card.appendChild(el("h3", name));
+
+			keys.forEach(function (k) {
+				var values = series[k];
+				var chart = card.appendChild(el("div", undefined, "chart"));
+				chart.appendChild(el("span", k, "label")).title = k;
+				chart.appendChild(sparkline(values));
+				chart.appendChild(el("span", format(values[values.length - 1]), "value"));
+			});
+		});
+	}
+
+	function refresh() {
+		return call("/cache").then(function (cache) {
+			var now = Date.now();
+			var seconds = lastPoll ? (now - lastPoll) / 1000 : 0;
+			lastPoll = now;
+
+			var workers = cache.Workers || {};
+			renderWorkers(workers);
+			Object.keys(workers).forEach(function (name) {
+				record(name, workers[name], seconds);
+			});
+			renderCharts();
+		}, function (err) {
+			notice("Unable to reach the leader: " + err.message);
+		});
+	}
+
+	function renderNodes(cluster) {
+		var body = $("nodes").tBodies[0];
+		body.textContent = "";
+
+		var nodes = cluster.Nodes || {};
+		Object.keys(nodes).sort().forEach(function (host) {
+			var n = nodes[host];
+			var health = "Unknown";
+			if (n.Reachable && n.Message && n.Message.Health) {
+				health = n.Message.Health;
+			}
+
+			var row = el("tr");
+			row.appendChild(el("td", host));
+			row.appendChild(el("td")).appendChild(badge(health, "health"));
+			row.appendChild(el("td", n.Reachable ? format(n.LatencyMs) + " ms" : "unreachable"));
+			row.appendChild(el("td", n.Error || "", "muted"));
+			body.appendChild(row);
+		});
+	}
+
+	// The cluster status fails as soon as one node is not
+	// healthy, its nodes are shown either way.
+	function refreshNodes() {
+		return fetch("/cluster/status", {cache: "no-store"}).then(function (r) {
+			return r.json();
+		}).then(function (res) {
+			renderNodes(res.message || {});
+		}, function () {
+			renderNodes({});
+		});
+	}
+
+	function renderTopology(config) {
+		var topology = $("topology");
+		topology.textContent = "";
+
+		if (!config || !config.Nodes) {
+			topology.appendChild(el("p", "No configuration available.", "muted"));
+			return;
+		}
+
+		$("node").textContent = location.hostname;
+
+		config.Nodes.forEach(function (node) {
+			topology.appendChild(el("h3", node.Hostname));
+
+			var workers = topology.appendChild(el("ul"));
+			(node.Workers || []).forEach(function (w) {
+				var item = workers.appendChild(el("li", w.Name));
+				var connections = item.appendChild(el("ul"));
+
+				(w.Connections || []).forEach(function (c) {
+					var arrow = /Ingress$/.test(c.Type) ? " ← " : " → ";
+					var text = c.Type + arrow + c.Worker + " (" + c.Alias + ")";
+					if (c.Delivery) {
+						text += ", " + c.Delivery;
+					}
+					connections.appendChild(el("li", text, "muted"));
+				});
+			});
+		});
+	}
+
+	function listen() {
+		if (!window.EventSource) {
+			return;
+		}
+
+		var source = new EventSource("/events");
+		var list = $("events");
+
+		["State", "Health", "Crash", "Restart", "Connector", "Peer"].forEach(function (kind) {
+			source.addEventListener(kind, function (e) {
+				var ev = JSON.parse(e.data);
+				var item = el("li", new Date(ev.Time).toLocaleTimeString() + " " + ev.Kind + " " +
+					(ev.Worker || "") + " " + JSON.stringify(ev.Data));
+				item.value = ev.ID;
+				list.insertBefore(item, list.firstChild);
+
+				while (list.children.length > EVENTS) {
+					list.removeChild(list.lastChild);
+				}
+
+				refresh();
+			});
+		});
+	}
+
+	$("start-all").onclick = function () {
+		act("/start");
+	};
+
+	$("stop-all").onclick = function () {
+		// Once the workers are stopped a stop shuts the leader down.
+		if (confirm("Stop every worker of this node?  When they are already stopped the leader shuts down.")) {
+			act("/stop");
+		}
+	};
+
+	call("/config").then(renderTopology, function () {
+		renderTopology(null);
+	});
+
+	refresh();
+	setInterval(refresh, POLL);
+	refreshNodes();
+	setInterval(refreshNodes, CLUSTER_POLL);
+	listen();
+})();
@@ -0,0 +1,330 @@
+/*
+	The metrics package gives every worker a registry of
+	counters, gauges and latency histograms.  Unlike the free
+	form value a worker answers a METRICS request with, the
+	snapshots of the registries share one structure so the
+	leader can merge them into node wide and distribution
+	wide views.
+*/
+package metrics
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The upper bounds in seconds of the buckets a histogram has
+// when it is created without any.
+var DefaultBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Returned when merging histograms with different buckets.
+var ErrBuckets = errors.New("metrics: histograms have different buckets")
+
+// A value that only goes up, such as the number of messages
+// a worker processed.
+type Counter struct {
+	value uint64
+}
+
+// Adds one to the counter.
+func (c *Counter) Inc() {
+	atomic.AddUint64(&c.value, 1)
+}
+
+// Adds n to the counter.
+func (c *Counter) Add(n uint64) {
+	atomic.AddUint64(&c.value, n)
+}
+
+// Returns the current value of the counter.
+func (c *Counter) Value() uint64 {
+	return atomic.LoadUint64(&c.value)
+}
+
+// A value that goes up and down, such as the size of a
+// worker's backlog.
+type Gauge struct {
+	bits uint64
+}
+
+// Sets the gauge to v.
+func (g *Gauge) Set(v float64) {
+	atomic.StoreUint64(&g.bits, math.Float64bits(v))
+}
+
+// Adds d, which may be negative, to the gauge.
+func (g *Gauge) Add(d float64) {
+	for {
+		old := atomic.LoadUint64(&g.bits)
+		if atomic.CompareAndSwapUint64(&g.bits, old, math.Float64bits(math.Float64frombits(old)+d)) {
+			return
+		}
+	}
+}
+
+// Returns the current value of the gauge.
+func (g *Gauge) Value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&g.bits))
+}
+
+// Counts observations, usually latencies in seconds, into
+// buckets by their upper bounds.
+type Histogram struct {
+	mu     sync.Mutex
+	bounds []float64
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// Creates a histogram with the given bucket upper bounds,
+// DefaultBuckets when there are none.
+func NewHistogram(buckets ...float64) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+
+	bounds := append([]float64(nil), buckets...)
+	sort.Float64s(bounds)
+
+	// The last bucket holds everything above the bounds.
+	return &Histogram{bounds: bounds, counts: make([]uint64, len(bounds)+1)}
+}
+
+// Records a single observation.
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.bounds, v)
+
+	h.mu.Lock()
+	h.counts[i] += 1
+	h.count += 1
+	h.sum += v
+	h.mu.Unlock()
+}
+
+// Records the seconds passed since start, for example:
+//
+//	defer h.Since(time.Now())
+func (h *Histogram) Since(start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+// Returns a copy of the histogram's current values.
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return HistogramSnapshot{
+		Bounds: append([]float64(nil), h.bounds...),
+		Counts: append([]uint64(nil), h.counts...),
+		Count:  h.count,
+		Sum:    h.sum,
+	}
+}
+
+// The values of a histogram at one point in time.  Counts
+// holds the observations of each bucket, not cumulative, with
+// one more entry than Bounds for the observations above them.
+type HistogramSnapshot struct {
+	Bounds []float64
+	Counts []uint64
+	Count  uint64
+	Sum    float64
+}
+
+// Adds the observations of o to the snapshot.  Both must have
+// the same buckets or ErrBuckets is returned.
+func (s *HistogramSnapshot) Merge(o HistogramSnapshot) error {
+	if s.Bounds == nil && s.Count == 0 {
+		s.Bounds = append([]float64(nil), o.Bounds...)
+		s.Counts = make([]uint64, len(o.Counts))
+	}
+
+	if len(s.Bounds) != len(o.Bounds) || len(s.Counts) != len(o.Counts) {
+		return ErrBuckets
+	}
+
+	for i := range s.Bounds {
+		if s.Bounds[i] != o.Bounds[i] {
+			return ErrBuckets
+		}
+	}
+
+	for i := range s.Counts {
+		s.Counts[i] += o.Counts[i]
+	}
+	s.Count += o.Count
+	s.Sum += o.Sum
+
+	return nil
+}
+
+// Estimates the q quantile, between 0 and 1, of the
+// observations by interpolating within its bucket.  Returns
+// NaN when there are no observations.
+func (s HistogramSnapshot) Quantile(q float64) float64 {
+	if s.Count == 0 {
+		return math.NaN()
+	}
+
+	rank := q * float64(s.Count)
+
+	var seen uint64
+	for i, c := range s.Counts {
+		if float64(seen+c) < rank || c == 0 {
+			seen += c
+			continue
+		}
+
+		// Nothing is known above the last bound.
+		if i == len(s.Bounds) {
+			return s.Bounds[len(s.Bounds)-1]
+		}
+
+		lower := 0.0
+		if i > 0 {
+			lower = s.Bounds[i-1]
+		}
+
+		return lower + (s.Bounds[i]-lower)*(rank-float64(seen))/float64(c)
+	}
+
+	return s.Bounds[len(s.Bounds)-1]
+}
+
+// Holds the named metrics of a worker, a metric is created
+// the first time it is asked for.  It is safe to use from
+// several go routines.
+type Registry struct {
+	mu         sync.Mutex
+	counters   map[string]*Counter
+	gauges     map[string]*Gauge
+	histograms map[string]*Histogram
+}
+
+// Creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		counters:   make(map[string]*Counter),
+		gauges:     make(map[string]*Gauge),
+		histograms: make(map[string]*Histogram),
+	}
+}
+
+// Returns the named counter.
+func (r *Registry) Counter(name string) *Counter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, ok := r.counters[name]
+	if !ok {
+		c = &Counter{}
+		r.counters[name] = c
+	}
+
+	return c
+}
+
+// Returns the named gauge.
+func (r *Registry) Gauge(name string) *Gauge {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	g, ok := r.gauges[name]
+	if !ok {
+		g = &Gauge{}
+		r.gauges[name] = g
+	}
+
+	return g
+}
+
+// Returns the named histogram, the buckets are only used
+// when it is created.
+func (r *Registry) Histogram(name string, buckets ...float64) *Histogram {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	h, ok := r.histograms[name]
+	if !ok {
+		h = NewHistogram(buckets...)
+		r.histograms[name] = h
+	}
+
+	return h
+}
+
+// Returns the current values of every metric in the registry.
+func (r *Registry) Snapshot() Snapshot {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := newSnapshot()
+
+	for k, c := range r.counters {
+		s.Counters[k] = c.Value()
+	}
+
+	for k, g := range r.gauges {
+		s.Gauges[k] = g.Value()
+	}
+
+	for k, h := range r.histograms {
+		s.Histograms[k] = h.Snapshot()
+	}
+
+	return s
+}
+
+// The values of a registry at one point in time.  Snapshots
+// of several workers, or of several nodes, are combined with
+// Merge.
+type Snapshot struct {
+	Counters   map[string]uint64
+	Gauges     map[string]float64
+	Histograms map[string]HistogramSnapshot
+}
+
+// Creates an empty snapshot.
+func newSnapshot() Snapshot {
+	return Snapshot{
+		Counters:   make(map[string]uint64),
+		Gauges:     make(map[string]float64),
+		Histograms: make(map[string]HistogramSnapshot),
+	}
+}
+
+// Merges the snapshots into a new one.  Counters, gauges and
+// histograms of the same name are added together, so a merged
+// gauge is the total over the snapshots.  Histograms with
+// different buckets are left out of the merge and ErrBuckets
+// is returned along with the rest.
+func Merge(snapshots ...Snapshot) (Snapshot, error) {
+	m := newSnapshot()
+
+	var err error
+	for _, s := range snapshots {
+		for k, v := range s.Counters {
+			m.Counters[k] += v
+		}
+
+		for k, v := range s.Gauges {
+			m.Gauges[k] += v
+		}
+
+		for k, v := range s.Histograms {
+			h := m.Histograms[k]
+			if e := h.Merge(v); e != nil {
+				err = e
+				continue
+			}
+			m.Histograms[k] = h
+		}
+	}
+
+	return m, err
+}
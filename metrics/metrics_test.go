@@ -0,0 +1,114 @@
+package metrics
+
+import (
+	"math"
+	"sync"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.Counter("Processed").Inc()
+			r.Gauge("Backlog").Add(1.5)
+			r.Histogram("Latency").Observe(0.02)
+		}()
+	}
+	wg.Wait()
+
+	r.Counter("Processed").Add(5)
+	r.Gauge("Backlog").Add(-5)
+
+	s := r.Snapshot()
+	if s.Counters["Processed"] != 15 || s.Gauges["Backlog"] != 10 {
+		t.Error("unexpected snapshot", s)
+	}
+
+	h := s.Histograms["Latency"]
+	if h.Count != 10 || math.Abs(h.Sum-0.2) > 1e-9 || len(h.Counts) != len(DefaultBuckets)+1 {
+		t.Error("unexpected histogram", h)
+	}
+
+	// 0.02 falls in the bucket up to 0.025.
+	if h.Counts[4] != 10 {
+		t.Error("unexpected buckets", h.Counts)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram(4, 1, 2)
+	for _, v := range []float64{0.5, 1, 1.5, 3, 8} {
+		h.Observe(v)
+	}
+
+	s := h.Snapshot()
+	if len(s.Bounds) != 3 || s.Bounds[0] != 1 || s.Bounds[2] != 4 {
+		t.Error("bounds are not sorted", s.Bounds)
+	}
+
+	for i, c := range []uint64{2, 1, 1, 1} {
+		if s.Counts[i] != c {
+			t.Error("unexpected counts", s.Counts)
+		}
+	}
+
+	if q := s.Quantile(0.4); q != 1 {
+		t.Error("unexpected quantile", q)
+	}
+
+	if q := s.Quantile(0.5); q != 1.5 {
+		t.Error("unexpected quantile", q)
+	}
+
+	if q := s.Quantile(1); q != 4 {
+		t.Error("unexpected quantile", q)
+	}
+
+	if q := (HistogramSnapshot{}).Quantile(0.5); !math.IsNaN(q) {
+		t.Error("unexpected quantile of nothing", q)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	a, b := NewRegistry(), NewRegistry()
+
+	a.Counter("Processed").Add(2)
+	b.Counter("Processed").Add(3)
+	b.Counter("Dropped").Inc()
+	a.Gauge("Backlog").Set(1)
+	b.Gauge("Backlog").Set(2)
+	a.Histogram("Latency").Observe(0.001)
+	b.Histogram("Latency").Observe(20)
+
+	m, err := Merge(a.Snapshot(), b.Snapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Counters["Processed"] != 5 || m.Counters["Dropped"] != 1 || m.Gauges["Backlog"] != 3 {
+		t.Error("unexpected merge", m)
+	}
+
+	h := m.Histograms["Latency"]
+	if h.Count != 2 || h.Counts[0] != 1 || h.Counts[len(h.Counts)-1] != 1 {
+		t.Error("unexpected merged histogram", h)
+	}
+
+	// The snapshots merged are left as they were.
+	if a.Snapshot().Histograms["Latency"].Count != 1 {
+		t.Error("merge changed a snapshot")
+	}
+
+	b.Histogram("Other", 1).Observe(1)
+	a.Histogram("Other").Observe(1)
+
+	m, err = Merge(a.Snapshot(), b.Snapshot())
+	if err != ErrBuckets || m.Counters["Processed"] != 5 {
+		t.Error("expected ErrBuckets and the rest merged", err, m)
+	}
+}
@@ -11,7 +11,9 @@ package worker
 
 import (
 	"github.com/go-emd/emd/connector"
+	"github.com/go-emd/emd/control"
 	"github.com/go-emd/emd/core"
+	"github.com/go-emd/emd/metrics"
 )
 
 // Perform's computation's and raw processing.
@@ -22,14 +24,46 @@ type Worker interface {
 	Name() string
 }
 
+// Implemented by the workers that keep a metrics.Registry, 
+// every worker inheriting worker.Work does.  The leader 
+// collects the registry through it.
+type Instrumented interface {
+	Metrics() *metrics.Registry
+}
+
 // The base worker.Work structure needs to be inherited by 
 // each worker implementation.  It contains the workers core.Core 
 // (name string) and all the ports pertaining to it including the 
-// MDGMT_<worker name> port which allows the workers to speak to 
-// its node leader.
+// MGMT_<worker name> port which allows the workers to speak to 
+// its node leader.  The leader opens every port before it runs 
+// the worker and closes them once the worker is stopped.
+//
+// The MGMT_<worker name> port is a control.Port, a worker reads 
+// the leader's requests from Control and answers them with Serve:
+//
+//	for {
+//		select {
+//		case req := <-w.Control():
+//			if w.Serve(req, w.status, w.metrics) {
+//				return
+//			}
+//		case data := <-w.Ports()["input"].Channel():
+//			start := time.Now()
+//			...
+//			w.Metrics().Counter("processed").Inc()
+//			w.Metrics().Histogram("latency").Since(start)
+//		}
+//	}
+//
+// The counters, gauges and histograms of Metrics are collected 
+// by the leader on its own, the worker does not need to report 
+// them in its answer to a METRICS request.  Each worker has its 
+// own registry, the leader creates it when it is initialized.
 type Work struct {
 	core.Core
 	Ports_ map[string]connector.Connector
+
+	registry *metrics.Registry
 }
 
 // Returns the ports that the worker contains.
@@ -41,3 +75,51 @@ func (w Work) Ports() map[string]connector.Connector {
 func (w Work) Name() string {
 	return w.Name_
 }
+
+// Returns the registry of the worker's counters, gauges and 
+// histograms, creating it the first time.
+func (w *Work) Metrics() *metrics.Registry {
+	if w.registry == nil {
+		w.registry = metrics.NewRegistry()
+	}
+
+	return w.registry
+}
+
+// Returns the channel the leader sends its control requests on, 
+// nil when the worker has no control.Port.
+func (w Work) Control() <-chan control.Request {
+	if p, ok := w.Ports_["MGMT_"+w.Name_].(*control.Port); ok {
+		return p.Requests
+	}
+
+	return nil
+}
+
+// Answers a control request using the status and metrics 
+// functions, when status is nil the worker is reported healthy.  
+// Returns true when the request asked the worker to stop, in 
+// which case the worker should return from Run.
+func (w Work) Serve(req control.Request, status, metrics func() interface{}) bool {
+	switch req.Kind {
+	case control.Stop:
+		req.Respond(nil)
+		return true
+	case control.Status:
+		if status == nil {
+			req.Respond("Healthy")
+		} else {
+			req.Respond(status())
+		}
+	case control.Metrics:
+		if metrics == nil {
+			req.Respond(nil)
+		} else {
+			req.Respond(metrics())
+		}
+	default:
+		req.Respond(nil)
+	}
+
+	return false
+}